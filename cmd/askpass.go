@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"golang.org/x/term"
+)
+
+// askpass 子进程通过这两个环境变量找到 kgate 进程并取回口令。口令本身不会出现在环境变量中：
+// 它只保存在 kgate 的内存里，经由只有当前用户能访问的 unix socket 交给 askpass，并且只交付一次
+const (
+	askpassSocketEnv = "KGATE_ASKPASS_SOCKET"
+	askpassTokenEnv  = "KGATE_ASKPASS_TOKEN"
+)
+
+// askpassServer 是本进程中为 askpass 提供口令的 socket 服务，首次需要时启动
+var askpassServer struct {
+	once    sync.Once
+	path    string
+	program string // 指向 kgate 自身的符号链接，见 askpassProgram
+	err     error
+	mu      sync.Mutex
+	secrets map[string]string // 一次性令牌 -> 口令
+}
+
+// askpassEnv 登记一个口令，返回让 ssh 通过 askpass 取得它所需的环境变量
+func askpassEnv(passphrase string) ([]string, error) {
+	askpassServer.once.Do(startAskpassServer)
+	if askpassServer.err != nil {
+		return nil, fmt.Errorf("starting askpass socket: %w", askpassServer.err)
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	askpassServer.mu.Lock()
+	askpassServer.secrets[hex.EncodeToString(token)] = passphrase
+	askpassServer.mu.Unlock()
+
+	return []string{
+		"SSH_ASKPASS=" + askpassServer.program,
+		"SSH_ASKPASS_REQUIRE=force",
+		askpassSocketEnv + "=" + askpassServer.path,
+		askpassTokenEnv + "=" + hex.EncodeToString(token),
+	}, nil
+}
+
+// askpassProgram 是 ssh 调用 askpass 时使用的程序名前缀
+// ssh 只会以提示文字作为唯一参数调用 SSH_ASKPASS，无法带上子命令，
+// 因此让 SSH_ASKPASS 指向一个名为 kgate-askpass-<pid> 的符号链接，Execute 根据 argv[0] 识别
+const askpassProgram = "kgate-askpass"
+
+// isAskpassInvocation 报告当前进程是否是被 ssh 作为 askpass 调用的
+func isAskpassInvocation() bool {
+	return strings.HasPrefix(filepath.Base(os.Args[0]), askpassProgram)
+}
+
+// startAskpassServer 在 ~/.config/.kgate/run 下监听 askpass-<pid>.sock，并创建指向自身的 askpass 链接
+// os.Exit 不会执行清理，因此启动时顺便删除已经退出的 kgate 进程遗留的文件
+func startAskpassServer() {
+	base, err := config.Dir()
+	if err != nil {
+		askpassServer.err = err
+		return
+	}
+	dir := filepath.Join(base, "run")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		askpassServer.err = err
+		return
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		askpassServer.err = err
+		return
+	}
+	removeStaleAskpassFiles(dir)
+
+	self, err := os.Executable()
+	if err != nil {
+		askpassServer.err = err
+		return
+	}
+	program := filepath.Join(dir, fmt.Sprintf("%s-%d", askpassProgram, os.Getpid()))
+	os.Remove(program)
+	if err := os.Symlink(self, program); err != nil {
+		askpassServer.err = err
+		return
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("askpass-%d.sock", os.Getpid()))
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		askpassServer.err = err
+		return
+	}
+	askpassServer.path = path
+	askpassServer.program = program
+	askpassServer.secrets = map[string]string{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveAskpass(conn)
+		}
+	}()
+}
+
+func serveAskpass(conn net.Conn) {
+	defer conn.Close()
+	token, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	token = strings.TrimSpace(token)
+	askpassServer.mu.Lock()
+	passphrase, ok := askpassServer.secrets[token]
+	delete(askpassServer.secrets, token)
+	askpassServer.mu.Unlock()
+	if ok {
+		fmt.Fprintln(conn, passphrase)
+	}
+}
+
+func removeStaleAskpassFiles(dir string) {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		name := e.Name()
+		var pid string
+		switch {
+		case strings.HasPrefix(name, "askpass-") && strings.HasSuffix(name, ".sock"):
+			pid = strings.TrimSuffix(strings.TrimPrefix(name, "askpass-"), ".sock")
+		case strings.HasPrefix(name, askpassProgram+"-"):
+			pid = strings.TrimPrefix(name, askpassProgram+"-")
+		default:
+			continue
+		}
+		if n, err := strconv.Atoi(pid); err != nil || errors.Is(syscall.Kill(n, 0), syscall.ESRCH) {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+}
+
+// runAskpass 是被 ssh 作为 SSH_ASKPASS 调用时的入口，args 是 ssh 给出的提示文字
+// 只有私钥口令的提示由 kgate 保存的口令回答，其它提示交还给用户在终端上回答
+func runAskpass(args []string) {
+	prompt := strings.Join(args, " ")
+	if strings.HasPrefix(prompt, "Enter passphrase for key") {
+		if value, ok := fetchAskpassSecret(); ok {
+			fmt.Println(value)
+			return
+		}
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		os.Exit(1)
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	switch {
+	case os.Getenv("SSH_ASKPASS_PROMPT") == "none":
+		// 只是通知，不需要回答
+		fmt.Fprintln(tty)
+		return
+	case os.Getenv("SSH_ASKPASS_PROMPT") == "confirm" || strings.Contains(prompt, "(yes/no"):
+		// 确认类的问题（例如主机密钥）回显输入
+		answer, err := bufio.NewReader(tty).ReadString('\n')
+		if err != nil && answer == "" {
+			os.Exit(1)
+		}
+		fmt.Println(strings.TrimRight(answer, "\r\n"))
+		return
+	}
+	// 其余的提示（口令、密码等）不回显
+	answer, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		os.Exit(1)
+	}
+	fmt.Println(string(answer))
+}
+
+// fetchAskpassSecret 向启动 ssh 的 kgate 进程取回登记的口令，每个令牌只能取回一次
+// 因此口令错误时 ssh 再次提示会转为在终端上询问用户
+func fetchAskpassSecret() (string, bool) {
+	path, token := os.Getenv(askpassSocketEnv), os.Getenv(askpassTokenEnv)
+	if path == "" || token == "" {
+		return "", false
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return "", false
+	}
+	defer conn.Close()
+	fmt.Fprintln(conn, token)
+	value, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimRight(value, "\n"), true
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gitlayzer/kgate/internal/transfer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	transferLimit    string
+	transferCompress string
+
+	// 由 parseBandwidthFlags 根据上面两个参数设置
+	transferLimiter *transfer.Limiter
+	compression     = transfer.CompressNone
+)
+
+// addBandwidthFlags 为传输命令注册 --limit 和 --compress
+func addBandwidthFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&transferLimit, "limit", "", "Limit the transfer rate in bytes per second, e.g. 10M or 512K")
+	cmd.Flags().StringVar(&transferCompress, "compress", "none", "Compress data in transit: gzip, zstd or none (zstd only for tar streams)")
+}
+
+// parseBandwidthFlags 解析 --limit 和 --compress
+func parseBandwidthFlags() error {
+	rate, err := transfer.ParseRate(transferLimit)
+	if transferLimit == "" {
+		rate, err = 0, nil
+	}
+	if err != nil {
+		return err
+	}
+	transferLimiter = transfer.NewLimiter(rate)
+	compression, err = transfer.ParseCompression(transferCompress)
+	return err
+}
+
+// requireStream 在数据经由 SFTP 传输时检查压缩方式
+// SFTP 会话只能使用 ssh 自带的压缩（相当于 gzip），zstd 只能用于 tar 流
+func requireStream(streaming bool) error {
+	if compression == transfer.CompressZstd && !streaming {
+		return fmt.Errorf("--compress zstd is only available for tar streams (--tar, or copies between nodes of the same cluster without --limit); use --compress gzip for SFTP transfers")
+	}
+	return nil
+}
+
+// sshCompressionArgs 返回 SFTP 会话中跳板机到节点这一跳使用的 ssh 压缩参数
+// 外层到跳板机的 ssh 不再压缩：内层压缩过的数据再压缩一次只会浪费跳板机的 CPU
+func sshCompressionArgs() []string {
+	if compression == transfer.CompressNone {
+		return nil
+	}
+	return []string{"-C"}
+}
+
+// pipefailPrefix 让节点 shell 中管道的退出状态反映其中任一命令的失败
+// 节点的登录 shell 不一定支持 pipefail，不支持时跳过而不是让整个命令失败
+const pipefailPrefix = "(set -o pipefail) 2>/dev/null && set -o pipefail; "
+
+// compressedPipeline 在节点上的命令前或后接上压缩命令
+// pack 为 true 时压缩 command 的输出，否则先解压 stdin 再交给 command
+func compressedPipeline(command string, pack bool) string {
+	c := compression.RemoteCommand(!pack)
+	switch {
+	case c == "":
+		return command
+	case pack:
+		return pipefailPrefix + command + " | " + c
+	default:
+		return pipefailPrefix + c + " | " + command
+	}
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/gitlayzer/kgate/internal/transfer"
+)
+
+func TestCompressedPipelineExitStatus(t *testing.T) {
+	shells := []string{"sh", "bash"}
+	tests := []struct {
+		name     string
+		command  string
+		pack     bool
+		pipefail bool // 只有支持 pipefail 的 shell 才能报告压缩命令之前的失败
+		wantErr  bool
+	}{
+		{name: "pack ok", command: "echo data", pack: true},
+		{name: "pack source fails", command: "false", pack: true, pipefail: true, wantErr: true},
+		{name: "unpack fails", command: "false", wantErr: true},
+	}
+	defer func(c transfer.Compression) { compression = c }(compression)
+	compression = transfer.CompressGzip
+	for _, shell := range shells {
+		if _, err := exec.LookPath(shell); err != nil {
+			continue
+		}
+		supported := exec.Command(shell, "-c", "set -o pipefail").Run() == nil
+		for _, tt := range tests {
+			t.Run(shell+"/"+tt.name, func(t *testing.T) {
+				script := compressedPipeline(tt.command, tt.pack)
+				if !tt.pack {
+					script = "echo data | gzip -c | { " + script + "; }"
+				}
+				err := exec.Command(shell, "-c", script+" >/dev/null").Run()
+				want := tt.wantErr && (supported || !tt.pipefail)
+				if (err != nil) != want {
+					t.Errorf("%s -c %q: err = %v, want error %v", shell, script, err, want)
+				}
+			})
+		}
+	}
+}
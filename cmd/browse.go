@@ -0,0 +1,628 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/transfer"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var browseCmd = &cobra.Command{
+	Use:   "browse [node-alias]",
+	Short: "Browse a node's files in an interactive SFTP shell",
+	Long: `Opens an sftp-like shell on a node, tunnelled through its cluster's bastion,
+to look around and move files without starting an interactive bash session.
+
+The shell keeps a remote and a local working directory. Remote paths are
+relative to the remote one (starting in the login user's home directory),
+local paths to the local one. Press Tab to complete commands and paths, and
+type 'help' for the list of commands. get/put overwrite existing files, like
+sftp; remote paths given to ls, get and rm may contain wildcards.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runBrowse,
+
+	ValidArgsFunction: completeNodeAlias,
+}
+
+// pathKind 表示命令参数补全时使用远端还是本地路径
+type pathKind int
+
+const (
+	remotePath pathKind = iota
+	localPath
+)
+
+// browseCommand 是文件浏览 shell 中的一个命令
+type browseCommand struct {
+	usage string
+	help  string
+	flags string     // 允许的单字母选项
+	args  []pathKind // 各个参数的补全方式，最后一个适用于其余所有参数
+	run   func(b *browser, flags map[rune]bool, args []string) error
+}
+
+var browseCommands map[string]browseCommand
+
+func init() {
+	browseCommands = map[string]browseCommand{
+		"ls":    {usage: "ls [-la] [path]", help: "List a remote directory", flags: "la", args: []pathKind{remotePath}, run: (*browser).ls},
+		"cd":    {usage: "cd [path]", help: "Change the remote directory (default: home)", args: []pathKind{remotePath}, run: (*browser).cd},
+		"pwd":   {usage: "pwd", help: "Print the remote directory", run: (*browser).pwd},
+		"get":   {usage: "get [-r] remote-path [local-path]", help: "Download files (wildcards allowed)", flags: "r", args: []pathKind{remotePath, localPath}, run: (*browser).get},
+		"put":   {usage: "put [-r] local-path [remote-path]", help: "Upload files (wildcards allowed)", flags: "r", args: []pathKind{localPath, remotePath}, run: (*browser).put},
+		"rm":    {usage: "rm [-r] path...", help: "Remove remote files, or directories with -r", flags: "r", args: []pathKind{remotePath}, run: (*browser).rm},
+		"mkdir": {usage: "mkdir [-p] path...", help: "Create remote directories", flags: "p", args: []pathKind{remotePath}, run: (*browser).mkdir},
+		"lls":   {usage: "lls [-la] [path]", help: "List a local directory", flags: "la", args: []pathKind{localPath}, run: (*browser).lls},
+		"lcd":   {usage: "lcd [path]", help: "Change the local directory (default: home)", args: []pathKind{localPath}, run: (*browser).lcd},
+		"lpwd":  {usage: "lpwd", help: "Print the local directory", run: (*browser).lpwd},
+		"help":  {usage: "help", help: "Show this help", run: (*browser).help},
+		"exit":  {usage: "exit", help: "Leave the shell (also quit, bye or Ctrl-D)"},
+	}
+	browseCommands["quit"] = browseCommands["exit"]
+	browseCommands["bye"] = browseCommands["exit"]
+	browseCommands["?"] = browseCommands["help"]
+}
+
+// browser 保存一次文件浏览会话的状态，本地当前目录即进程的工作目录
+type browser struct {
+	client *transfer.Client
+	node   *config.Node
+	home   string // 远端家目录
+	cwd    string // 远端当前目录
+}
+
+func runBrowse(cmd *cobra.Command, args []string) {
+	node, cluster, err := cfg.FindNode(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("--> Opening SFTP session to %s (%s) via bastion %s...\n", node.Alias, node.IP, cluster.Name)
+	client, err := openSFTP(cluster, node)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+	home, err := client.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	b := &browser{client: client, node: node, home: home, cwd: home}
+
+	rlConfig := &readline.Config{
+		Prompt:          b.prompt(),
+		AutoComplete:    b,
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	}
+	if dir, err := config.Dir(); err == nil {
+		rlConfig.HistoryFile = filepath.Join(dir, "browse_history")
+	}
+	rl, err := readline.NewEx(rlConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	defer rl.Close()
+
+	fmt.Println("Type 'help' for the list of commands.")
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		words, _, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		command, ok := browseCommands[words[0]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: unknown command '%s' (type 'help' for the list of commands)\n", words[0])
+			continue
+		}
+		if command.run == nil {
+			return
+		}
+		flags, rest, err := parseBrowseFlags(words[1:], command.flags)
+		if err == nil {
+			err = command.run(b, flags, rest)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		rl.SetPrompt(b.prompt())
+	}
+}
+
+func (b *browser) prompt() string {
+	cwd := b.cwd
+	if cwd == b.home {
+		cwd = "~"
+	} else if strings.HasPrefix(cwd, b.home+"/") {
+		cwd = "~" + strings.TrimPrefix(cwd, b.home)
+	}
+	return fmt.Sprintf("%s:%s> ", b.node.Alias, cwd)
+}
+
+// remote 将命令中的远端路径转换为绝对路径，~ 表示远端家目录，空字符串表示远端当前目录
+func (b *browser) remote(p string) string {
+	switch {
+	case p == "~":
+		return b.home
+	case strings.HasPrefix(p, "~/"):
+		return path.Join(b.home, p[2:])
+	case path.IsAbs(p):
+		return path.Clean(p)
+	}
+	return path.Join(b.cwd, p)
+}
+
+// local 展开命令中本地路径开头的 ~，相对路径仍然相对于进程的工作目录
+func local(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[1:])
+}
+
+// parseBrowseFlags 从参数开头取出 -r、-la 这样的单字母选项，allowed 是允许的选项字母
+func parseBrowseFlags(args []string, allowed string) (map[rune]bool, []string, error) {
+	flags := map[rune]bool{}
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		if args[0] == "--" {
+			return flags, args[1:], nil
+		}
+		for _, r := range args[0][1:] {
+			if !strings.ContainsRune(allowed, r) {
+				return nil, nil, fmt.Errorf("unknown option -%c", r)
+			}
+			flags[r] = true
+		}
+		args = args[1:]
+	}
+	return flags, args, nil
+}
+
+// splitArgs 按 shell 的规则拆分命令行，支持单引号、双引号和反斜杠转义
+// last 是最后一个参数在命令行中的原始文本，补全时使用；命令行以空白结尾时为空
+func splitArgs(line string) (args []string, last string, err error) {
+	var cur strings.Builder
+	var quote rune
+	inWord, escaped := false, false
+	start := 0
+	for i, r := range line {
+		if !inWord && r != ' ' && r != '\t' {
+			start = i
+		}
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, cur.String())
+		last = line[start:]
+	}
+	if quote != 0 || escaped {
+		err = fmt.Errorf("unterminated quote or escape")
+	}
+	return args, last, err
+}
+
+// escapeArg 用反斜杠转义补全结果中对命令行有特殊含义的字符
+func escapeArg(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(" \t'\"\\", r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Do 实现 readline.AutoCompleter：第一个词补全命令，其余的按命令补全远端或本地路径
+func (b *browser) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	args, last, _ := splitArgs(text)
+	current := ""
+	if last != "" {
+		current = args[len(args)-1]
+		args = args[:len(args)-1]
+	}
+	if len(args) == 0 {
+		var names []string
+		for name := range browseCommands {
+			if strings.HasPrefix(name, current) {
+				names = append(names, name[len(current):]+" ")
+			}
+		}
+		sort.Strings(names)
+		return toRunes(names), len([]rune(current))
+	}
+
+	command, ok := browseCommands[args[0]]
+	if !ok || len(command.args) == 0 || strings.HasPrefix(current, "-") {
+		return nil, 0
+	}
+	_, rest, err := parseBrowseFlags(args[1:], command.flags)
+	if err != nil {
+		return nil, 0
+	}
+	kind := command.args[min(len(rest), len(command.args)-1)]
+
+	dir, prefix := "", current
+	if i := strings.LastIndex(current, "/"); i >= 0 {
+		dir, prefix = current[:i+1], current[i+1:]
+	}
+	var entries []fs.FileInfo
+	if kind == remotePath {
+		entries, _ = b.client.ReadDir(b.remote(dir))
+	} else {
+		if dir == "" {
+			dir = "."
+		}
+		entries, _ = readLocalDir(local(dir))
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		suffix := escapeArg(name[len(prefix):])
+		if e.IsDir() {
+			suffix += "/"
+		} else {
+			suffix += " "
+		}
+		names = append(names, suffix)
+	}
+	sort.Strings(names)
+	// 前缀长度按命令行中的原始文本计算，其中可能含有转义字符
+	rawPrefix := last
+	if i := strings.LastIndex(last, "/"); i >= 0 {
+		rawPrefix = last[i+1:]
+	}
+	return toRunes(names), len([]rune(rawPrefix))
+}
+
+func toRunes(names []string) [][]rune {
+	out := make([][]rune, len(names))
+	for i, name := range names {
+		out[i] = []rune(name)
+	}
+	return out
+}
+
+func readLocalDir(dir string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var infos []fs.FileInfo
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			// 指向目录的符号链接按目录补全
+			if e.Type()&fs.ModeSymlink != 0 {
+				if target, err := os.Stat(filepath.Join(dir, e.Name())); err == nil {
+					info = target
+				}
+			}
+			infos = append(infos, renamedInfo{FileInfo: info, name: e.Name()})
+		}
+	}
+	return infos, nil
+}
+
+// renamedInfo 保留目录项原本的名称，os.Stat 符号链接返回的是目标的信息
+type renamedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i renamedInfo) Name() string { return i.name }
+
+func (b *browser) ls(flags map[rune]bool, args []string) error {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	var entries []fs.FileInfo
+	for _, arg := range args {
+		p := b.remote(arg)
+		matches, err := expandRemote(b.client, p)
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			info, err := b.client.Stat(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", m, err)
+			}
+			if !info.IsDir() || len(matches) > 1 {
+				entries = append(entries, renamedInfo{FileInfo: info, name: path.Base(m)})
+				continue
+			}
+			list, err := b.client.ReadDir(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", m, err)
+			}
+			entries = append(entries, list...)
+		}
+	}
+	printListing(entries, flags)
+	return nil
+}
+
+func (b *browser) lls(flags map[rune]bool, args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = local(args[0])
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	entries := []fs.FileInfo{info}
+	if info.IsDir() {
+		if entries, err = readLocalDir(dir); err != nil {
+			return err
+		}
+	}
+	printListing(entries, flags)
+	return nil
+}
+
+// printListing 按名称排序输出目录项：-l 时每行一个并显示权限、大小和修改时间，否则按列排列
+// 不带 -a 时不显示以 . 开头的文件
+func printListing(entries []fs.FileInfo, flags map[rune]bool) {
+	var shown []fs.FileInfo
+	for _, e := range entries {
+		if flags['a'] || !strings.HasPrefix(e.Name(), ".") {
+			shown = append(shown, e)
+		}
+	}
+	sort.Slice(shown, func(i, j int) bool { return shown[i].Name() < shown[j].Name() })
+
+	if flags['l'] {
+		for _, e := range shown {
+			fmt.Printf("%s %10d %s %s\n", e.Mode(), e.Size(), e.ModTime().Format("Jan _2 15:04 2006"), displayName(e))
+		}
+		return
+	}
+	names := make([]string, len(shown))
+	longest := 0
+	for i, e := range shown {
+		names[i] = displayName(e)
+		longest = max(longest, len([]rune(names[i])))
+	}
+	width := 80
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		width = w
+	}
+	perLine := max(width/(longest+2), 1)
+	for i, name := range names {
+		fmt.Print(name)
+		if (i+1)%perLine == 0 || i == len(names)-1 {
+			fmt.Println()
+		} else {
+			fmt.Print(strings.Repeat(" ", longest+2-len([]rune(name))))
+		}
+	}
+}
+
+func displayName(e fs.FileInfo) string {
+	if e.IsDir() {
+		return e.Name() + "/"
+	}
+	return e.Name()
+}
+
+func (b *browser) cd(_ map[rune]bool, args []string) error {
+	p := b.remote(firstOr(args, "~"))
+	info, err := b.client.Stat(p)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", p)
+	}
+	b.cwd = p
+	return nil
+}
+
+func (b *browser) pwd(_ map[rune]bool, _ []string) error {
+	fmt.Printf("Remote working directory: %s\n", b.cwd)
+	return nil
+}
+
+func (b *browser) lcd(_ map[rune]bool, args []string) error {
+	return os.Chdir(local(firstOr(args, "~")))
+}
+
+func (b *browser) lpwd(_ map[rune]bool, _ []string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Local working directory: %s\n", wd)
+	return nil
+}
+
+func (b *browser) help(_ map[rune]bool, _ []string) error {
+	for _, name := range []string{"ls", "cd", "pwd", "get", "put", "rm", "mkdir", "lls", "lcd", "lpwd", "help", "exit"} {
+		c := browseCommands[name]
+		fmt.Printf("  %-36s %s\n", c.usage, c.help)
+	}
+	return nil
+}
+
+// browseMode 返回 get/put 的 copyMode：与 sftp 一样直接覆盖已有文件，-r 复制目录
+func browseMode(flags map[rune]bool) copyMode {
+	return copyMode{recursive: flags['r'], force: true}
+}
+
+// get 下载远端文件，目标路径的规则与 kgate scp 相同
+func (b *browser) get(flags map[rune]bool, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: %s", browseCommands["get"].usage)
+	}
+	sources, err := planRemoteSources(b.client, b.remote(args[0]), localStat, filepath.Join, filepath.Dir, local(firstOr(args[1:], ".")), browseMode(flags))
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, src := range sources {
+		total += src.size
+	}
+	progress := startTransferProgress(total)
+	defer progress.Stop()
+	for _, src := range sources {
+		if err := b.client.Download(src.path, src.final, transfer.Options{Progress: progress.Add, OnSkip: warnSkipped}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// put 上传本地文件，本地路径可以含有通配符
+func (b *browser) put(flags map[rune]bool, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: %s", browseCommands["put"].usage)
+	}
+	matches, err := filepath.Glob(local(args[0]))
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("%s: no such file or directory", args[0])
+	}
+	dest := b.cwd
+	if len(args) == 2 {
+		dest = b.remote(args[1])
+		// remote 会去掉结尾的 /，而它表示目标必须是目录
+		if strings.HasSuffix(args[1], "/") && dest != "/" {
+			dest += "/"
+		}
+	}
+
+	finals := make([]string, len(matches))
+	var total int64
+	for i, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil {
+			return err
+		}
+		if finals[i], err = resolveDestination(sftpStat(b.client), path.Join, path.Dir, dest, filepath.Base(m), info.IsDir(), len(matches) > 1, browseMode(flags)); err != nil {
+			return err
+		}
+		size, err := transfer.LocalSize(m)
+		if err != nil {
+			return err
+		}
+		total += size
+	}
+	progress := startTransferProgress(total)
+	defer progress.Stop()
+	for i, m := range matches {
+		if err := b.client.Upload(m, finals[i], transfer.Options{Progress: progress.Add}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *browser) rm(flags map[rune]bool, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", browseCommands["rm"].usage)
+	}
+	for _, arg := range args {
+		matches, err := expandRemote(b.client, b.remote(arg))
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			info, err := b.client.Lstat(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", m, err)
+			}
+			switch {
+			case !info.IsDir():
+				err = b.client.Remove(m)
+			case flags['r']:
+				err = b.client.RemoveAll(m)
+			default:
+				err = errors.New("is a directory (use rm -r)")
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", m, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *browser) mkdir(flags map[rune]bool, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", browseCommands["mkdir"].usage)
+	}
+	for _, arg := range args {
+		p := b.remote(arg)
+		mkdir := b.client.Mkdir
+		if flags['p'] {
+			mkdir = b.client.MkdirAll
+		}
+		if err := mkdir(p); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+func firstOr(args []string, def string) string {
+	if len(args) == 0 {
+		return def
+	}
+	return args[0]
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line    string
+		args    []string
+		last    string
+		wantErr bool
+	}{
+		{line: "", args: nil},
+		{line: "   ", args: nil},
+		{line: "ls", args: []string{"ls"}, last: "ls"},
+		{line: "get  -r\tlogs ", args: []string{"get", "-r", "logs"}},
+		{line: "get 'my file' dst", args: []string{"get", "my file", "dst"}, last: "dst"},
+		{line: `put "a b"c`, args: []string{"put", "a bc"}, last: `"a b"c`},
+		{line: `cd my\ dir`, args: []string{"cd", "my dir"}, last: `my\ dir`},
+		{line: `get "say \"hi\""`, args: []string{"get", `say "hi"`}, last: `"say \"hi\""`},
+		{line: `get 'a\b'`, args: []string{"get", `a\b`}, last: `'a\b'`},
+		{line: `rm ''`, args: []string{"rm", ""}, last: `''`},
+		{line: `get 'unterminated`, args: []string{"get", "unterminated"}, last: `'unterminated`, wantErr: true},
+		{line: `get trailing\`, args: []string{"get", "trailing"}, last: `trailing\`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			args, last, err := splitArgs(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitArgs(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			}
+			if !slices.Equal(args, tt.args) || last != tt.last {
+				t.Errorf("splitArgs(%q) = %q, %q; want %q, %q", tt.line, args, last, tt.args, tt.last)
+			}
+		})
+	}
+}
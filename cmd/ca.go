@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gitlayzer/kgate/internal/ca"
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	caSignPrincipals []string
+	caSignTTL        string
+	caSignIdentity   string
+)
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage the local CA used to sign short-lived SSH certificates",
+	Long: `Instead of distributing long-lived keys, kgate can sign an ephemeral key with a
+local CA before each connection. Enable it per cluster with a 'certificate' section:
+
+  certificate:
+    principals: [ubuntu, root]
+    ttl: 15m
+
+Bastions and nodes must trust the CA, e.g. 'TrustedUserCAKeys /etc/ssh/kgate_ca.pub'
+in sshd_config, with the output of 'kgate ca show'.
+
+The certificate is reused until shortly before it expires. Its private key only lives
+in a dedicated ssh-agent, which is forwarded to the nodes only when the cluster enables
+forwardAgent; otherwise the inner hop authenticates with the bastion's own keys.`,
+}
+
+var caInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Generate the CA key pair",
+	Run: func(cmd *cobra.Command, args []string) {
+		keyPath, err := ca.KeyPath(cfg.CA)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if err := ca.Init(keyPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		pub, err := os.ReadFile(keyPath + ".pub")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ CA key written to %s\n", keyPath)
+		fmt.Println("Add this public key to TrustedUserCAKeys on your bastions and nodes:")
+		fmt.Print(string(pub))
+	},
+}
+
+var caShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the CA public key",
+	Run: func(cmd *cobra.Command, args []string) {
+		keyPath, err := ca.KeyPath(cfg.CA)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		pub, err := os.ReadFile(keyPath + ".pub")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: CA not initialised, run 'kgate ca init' first")
+			os.Exit(1)
+		}
+		fmt.Print(string(pub))
+	},
+}
+
+var caSignCmd = &cobra.Command{
+	Use:   "sign [public-key-file]",
+	Short: "Sign a public key, or a fresh ephemeral key for --cluster",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterName, _ := cmd.Flags().GetString("cluster")
+		var cluster *config.Cluster
+		if clusterName != "" {
+			c, err := cfg.FindCluster(clusterName)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			cluster = c
+		}
+		if len(args) == 0 && cluster == nil {
+			fmt.Fprintln(os.Stderr, "Error: either a public key file or --cluster is required")
+			os.Exit(1)
+		}
+
+		if len(args) == 0 {
+			keyPath, certPath, err := issueCertificate(cluster)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("✅ Ephemeral key: %s\n✅ Certificate:   %s\n", keyPath, certPath)
+			fmt.Println("The unencrypted key is deleted together with the certificate once the certificate expires.")
+			return
+		}
+
+		principals := caSignPrincipals
+		if len(principals) == 0 && cluster != nil {
+			principals = clusterPrincipals(cluster)
+		}
+		ttl, err := certificateTTL(cluster)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		identity := caSignIdentity
+		if identity == "" {
+			identity = certificateIdentity(clusterName)
+		}
+		caKey, err := ca.KeyPath(cfg.CA)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		certPath, err := ca.Sign(caKey, args[0], identity, principals, ttl)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Certificate for %s valid for %s written to %s\n", strings.Join(principals, ","), ttl, certPath)
+	},
+}
+
+// issueCertificate 为集群生成一把临时密钥并用 CA 签发证书，返回私钥和证书路径
+// 私钥未加密，需要由用户自己使用，因此留在磁盘上，证书过期后由 pruneCertificates 连同证书一起删除
+func issueCertificate(cluster *config.Cluster) (keyPath, certPath string, err error) {
+	caKey, err := ca.KeyPath(cfg.CA)
+	if err != nil {
+		return "", "", err
+	}
+	ttl, err := certificateTTL(cluster)
+	if err != nil {
+		return "", "", err
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", "", err
+	}
+	// 每次连接使用独立的目录，这样并发的连接不会互相覆盖或删除对方的临时密钥
+	certsDir := filepath.Join(dir, "certs")
+	if err := os.MkdirAll(certsDir, 0700); err != nil {
+		return "", "", err
+	}
+	pruneCertificates()
+	keyDir, err := os.MkdirTemp(certsDir, cluster.Name+"-")
+	if err != nil {
+		return "", "", err
+	}
+	keyPath, err = ca.NewKey(keyDir, "id_ed25519")
+	if err != nil {
+		return "", "", err
+	}
+	certPath, err = ca.Sign(caKey, keyPath+".pub", certificateIdentity(cluster.Name), clusterPrincipals(cluster), ttl)
+	if err != nil {
+		os.RemoveAll(keyDir)
+		return "", "", err
+	}
+	expires := time.Now().Add(ttl)
+	if err := os.WriteFile(filepath.Join(keyDir, "expires"), []byte(fmt.Sprint(expires.Unix())), 0600); err != nil {
+		os.RemoveAll(keyDir)
+		return "", "", err
+	}
+	return keyPath, certPath, nil
+}
+
+// pruneCertificates 删除 ca sign --cluster 签发的、证书已经过期的目录，包括其中未加密的私钥
+// 没有记录过期时间的目录在创建一天后删除
+func pruneCertificates() {
+	dir, err := config.Dir()
+	if err != nil {
+		return
+	}
+	certsDir := filepath.Join(dir, "certs")
+	entries, err := os.ReadDir(certsDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		keyDir := filepath.Join(certsDir, entry.Name())
+		expires := info.ModTime().Add(24 * time.Hour)
+		if data, err := os.ReadFile(filepath.Join(keyDir, "expires")); err == nil {
+			if sec, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+				expires = time.Unix(sec, 0)
+			}
+		}
+		if time.Now().After(expires) {
+			os.RemoveAll(keyDir)
+		}
+	}
+}
+
+// certificateTTL 返回集群证书的有效期，依次使用 --ttl、集群配置和 CA 配置
+func certificateTTL(cluster *config.Cluster) (time.Duration, error) {
+	if caSignTTL != "" {
+		return ca.ParseTTL(caSignTTL)
+	}
+	if cluster != nil && cluster.Certificate != nil && cluster.Certificate.TTL != "" {
+		return ca.ParseTTL(cluster.Certificate.TTL)
+	}
+	if cfg.CA != nil {
+		return ca.ParseTTL(cfg.CA.TTL)
+	}
+	return ca.DefaultTTL, nil
+}
+
+// clusterPrincipals 返回集群证书的 principals，未配置时使用跳板机和节点的用户名
+func clusterPrincipals(cluster *config.Cluster) []string {
+	if len(caSignPrincipals) > 0 {
+		return caSignPrincipals
+	}
+	if cluster.Certificate != nil && len(cluster.Certificate.Principals) > 0 {
+		return cluster.Certificate.Principals
+	}
+	seen := map[string]bool{}
+	var principals []string
+	for _, name := range append([]string{cluster.Bastion.User}, nodeUsers(cluster)...) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			principals = append(principals, name)
+		}
+	}
+	return principals
+}
+
+func nodeUsers(cluster *config.Cluster) []string {
+	var users []string
+	for _, node := range cluster.Nodes {
+		users = append(users, node.User)
+	}
+	return users
+}
+
+// certificateIdentity 返回写入证书的 key id，便于在服务器日志中追溯
+func certificateIdentity(cluster string) string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	if cluster == "" {
+		return fmt.Sprintf("kgate:%s@%s", name, host)
+	}
+	return fmt.Sprintf("kgate:%s@%s:%s", name, host, cluster)
+}
+
+func init() {
+	caSignCmd.Flags().String("cluster", "", "Sign for this cluster (principals and ttl default to its configuration)")
+	caSignCmd.Flags().StringSliceVar(&caSignPrincipals, "principals", nil, "Comma-separated list of principals")
+	caSignCmd.Flags().StringVar(&caSignTTL, "ttl", "", "Certificate validity, e.g. 15m or 8h")
+	caSignCmd.Flags().StringVar(&caSignIdentity, "identity", "", "Key identity recorded in the certificate")
+
+	caCmd.AddCommand(caInitCmd)
+	caCmd.AddCommand(caShowCmd)
+	caCmd.AddCommand(caSignCmd)
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gitlayzer/kgate/internal/ca"
+	"github.com/gitlayzer/kgate/internal/config"
+)
+
+// certRenewMargin 是证书到期前停止复用的时间，保证复用的证书在 ssh 完成认证前不会过期
+const certRenewMargin = time.Minute
+
+// certSession 是集群当前使用的短期证书。私钥只保存在一个专用的 ssh-agent 中（加载后立即从磁盘删除），
+// 磁盘上只留下公钥和证书；证书有效期内的所有连接，包括并发的连接和 Tab 补全，都复用同一张证书
+type certSession struct {
+	socket  string // 专用 ssh-agent 的 socket
+	pubKey  string
+	cert    string
+	expires time.Time
+}
+
+// certSessions 缓存本进程中已经确认可用的证书
+var (
+	certSessionsMu sync.Mutex
+	certSessions   = map[string]*certSession{}
+)
+
+// clusterCertificate 返回集群可用的短期证书，没有可复用的证书时签发一张新的
+// 多个 kgate 进程之间通过文件锁串行化签发，不会互相覆盖
+func clusterCertificate(cluster *config.Cluster) (*certSession, error) {
+	certSessionsMu.Lock()
+	defer certSessionsMu.Unlock()
+	if s := certSessions[cluster.Name]; s != nil && s.usable() {
+		return s, nil
+	}
+	// 顺便清理 ca sign --cluster 留下的过期证书和私钥
+	pruneCertificates()
+
+	base, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(base, "agents", cluster.Name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(dir+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+
+	s := loadCertSession(dir)
+	if !s.usable() || !s.agentHasKey() {
+		if err := s.issue(cluster, dir); err != nil {
+			return nil, err
+		}
+	}
+	certSessions[cluster.Name] = s
+	return s, nil
+}
+
+// cachedCertificate 返回集群已经签发且仍可复用的证书，不会签发新证书；没有时返回 nil
+func cachedCertificate(cluster *config.Cluster) *certSession {
+	certSessionsMu.Lock()
+	defer certSessionsMu.Unlock()
+	if s := certSessions[cluster.Name]; s != nil && s.usable() {
+		return s
+	}
+	base, err := config.Dir()
+	if err != nil {
+		return nil
+	}
+	s := loadCertSession(filepath.Join(base, "agents", cluster.Name))
+	if !s.usable() || !s.agentHasKey() {
+		return nil
+	}
+	certSessions[cluster.Name] = s
+	return s
+}
+
+// loadCertSession 读取 dir 中上一次签发的证书信息，没有时 expires 为零值
+func loadCertSession(dir string) *certSession {
+	s := &certSession{
+		socket: filepath.Join(dir, "agent.sock"),
+		pubKey: filepath.Join(dir, "id_ed25519.pub"),
+		cert:   filepath.Join(dir, "id_ed25519-cert.pub"),
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "expires")); err == nil {
+		if sec, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			s.expires = time.Unix(sec, 0)
+		}
+	}
+	return s
+}
+
+func (s *certSession) usable() bool {
+	return time.Until(s.expires) > certRenewMargin
+}
+
+// agentHasKey 报告专用 ssh-agent 是否仍在运行并持有证书对应的私钥
+func (s *certSession) agentHasKey() bool {
+	pub, err := os.ReadFile(s.pubKey)
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(pub))
+	if len(fields) < 2 {
+		return false
+	}
+	list := exec.Command("ssh-add", "-L")
+	list.Env = append(os.Environ(), "SSH_AUTH_SOCK="+s.socket)
+	out, err := list.Output()
+	return err == nil && bytes.Contains(out, []byte(fields[1]))
+}
+
+// issue 生成新的临时密钥并签发证书，再启动一个只持有这把私钥的 ssh-agent
+// agent 在证书过期后自行退出；ssh-add 无论成功与否，私钥都会立即从磁盘删除
+func (s *certSession) issue(cluster *config.Cluster, dir string) error {
+	caKey, err := ca.KeyPath(cfg.CA)
+	if err != nil {
+		return err
+	}
+	ttl, err := certificateTTL(cluster)
+	if err != nil {
+		return err
+	}
+	if ttl <= certRenewMargin {
+		return fmt.Errorf("certificate ttl %s is too short, it must be longer than %s", ttl, certRenewMargin)
+	}
+	keyPath, err := ca.NewKey(dir, "id_ed25519")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(keyPath)
+	if _, err := ca.Sign(caKey, keyPath+".pub", certificateIdentity(cluster.Name), clusterPrincipals(cluster), ttl); err != nil {
+		return err
+	}
+
+	// 旧的 agent（如果还在运行）会在它自己的证书过期后退出，这里只需要换一个新的 socket
+	os.Remove(s.socket)
+	agent := exec.Command("sh", "-c", `ssh-agent -D -a "$1" >/dev/null 2>&1 & pid=$!; (sleep "$2"; kill $pid) >/dev/null 2>&1 &`,
+		"kgate", s.socket, fmt.Sprint(int(ttl.Seconds())))
+	agent.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := agent.Run(); err != nil {
+		return fmt.Errorf("starting ssh-agent: %w", err)
+	}
+	for i := 0; ; i++ {
+		if _, err := os.Stat(s.socket); err == nil {
+			break
+		}
+		if i == 100 {
+			return fmt.Errorf("ssh-agent did not create %s", s.socket)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 私钥在 agent 中比证书早一点过期，避免出示一张刚好过期的证书
+	add := exec.Command("ssh-add", "-q", "-t", fmt.Sprint(int((ttl - certRenewMargin).Seconds())), keyPath)
+	add.Env = append(os.Environ(), "SSH_AUTH_SOCK="+s.socket)
+	var stderr bytes.Buffer
+	add.Stderr = &stderr
+	if err := add.Run(); err != nil {
+		return fmt.Errorf("ssh-add: %w", commandError(err, &stderr))
+	}
+
+	if !cluster.Bastion.ForwardAgent {
+		fmt.Fprintf(os.Stderr, "Note: cluster '%s' does not enable forwardAgent, so the certificate is only presented to the bastion; nodes are reached with the bastion's own keys.\n", cluster.Name)
+	}
+	s.expires = time.Now().Add(ttl)
+	return os.WriteFile(filepath.Join(dir, "expires"), []byte(fmt.Sprint(s.expires.Unix())), 0600)
+}
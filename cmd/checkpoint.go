@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/scan"
+)
+
+// scanCheckpoint 记录一次扫描的进度，用于中断后通过 --resume 继续
+// Done 是按扫描顺序已经全部完成的地址数量，Hosts 只包含这部分地址中的结果
+type scanCheckpoint struct {
+	path    string
+	Key     string           `json:"key"`
+	Done    uint64           `json:"done"`
+	Skipped int              `json:"skipped"`
+	Hosts   []discoveredHost `json:"hosts"`
+}
+
+// checkpointPath 返回本次扫描参数对应的检查点文件，参数完全相同的扫描才能互相恢复
+// key 包含所有会影响记录结果的参数：扫描范围、端口、是否读取主机密钥指纹以及连接超时
+func checkpointPath(cluster *config.Cluster, targets *scan.Targets) (path, key string, err error) {
+	key = checkpointKey(cluster.Name, targets.String())
+
+	dir, err := config.Dir()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(key))
+	name := fmt.Sprintf("%s-%s.json", cluster.Name, hex.EncodeToString(sum[:8]))
+	return filepath.Join(dir, "discover", name), key, nil
+}
+
+// checkpointKey 由集群、扫描范围和 discover 的参数组成检查点的 key
+func checkpointKey(cluster, targets string) string {
+	excludes := append([]string(nil), discoverExclude...)
+	sort.Strings(excludes)
+	ports := append([]int(nil), discoverPorts...)
+	sort.Ints(ports)
+	portNames := make([]string, len(ports))
+	for i, port := range ports {
+		portNames[i] = fmt.Sprint(port)
+	}
+	return strings.Join([]string{
+		cluster,
+		targets,
+		strings.Join(excludes, ","),
+		discoverPort,
+		strings.Join(portNames, ","),
+		fmt.Sprintf("fingerprint=%t", discoverFingerprint),
+		"timeout=" + discoverTimeout.String(),
+	}, "|")
+}
+
+// loadCheckpoint 读取检查点，文件不存在时返回一个空的检查点
+func loadCheckpoint(cluster *config.Cluster, targets *scan.Targets) (*scanCheckpoint, error) {
+	path, key, err := checkpointPath(cluster, targets)
+	if err != nil {
+		return nil, err
+	}
+	cp := &scanCheckpoint{path: path, Key: key}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("读取扫描检查点 %s 时出错: %w", path, err)
+	}
+	if cp.Key != key {
+		return &scanCheckpoint{path: path, Key: key}, nil
+	}
+	return cp, nil
+}
+
+// Exists 判断检查点文件是否存在
+func (cp *scanCheckpoint) Exists() bool {
+	_, err := os.Stat(cp.path)
+	return err == nil
+}
+
+// Save 原子地写入检查点
+func (cp *scanCheckpoint) Save() error {
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cp.path)
+}
+
+// Remove 在扫描完成后删除检查点
+func (cp *scanCheckpoint) Remove() error {
+	if err := os.Remove(cp.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckpointKey(t *testing.T) {
+	reset := func() {
+		discoverExclude, discoverPort, discoverPorts = []string{"10.0.0.9", "10.0.0.1"}, "22", []int{6443, 5432}
+		discoverFingerprint, discoverTimeout = false, 2*time.Second
+	}
+	defer func(rate int) { discoverRate = rate }(discoverRate)
+	defer func() {
+		discoverExclude, discoverPort, discoverPorts = nil, "22", nil
+		discoverFingerprint, discoverTimeout = false, 2*time.Second
+	}()
+	reset()
+	base := checkpointKey("prod", "10.0.0.0/24")
+
+	tests := []struct {
+		name   string
+		change func()
+		same   bool
+	}{
+		{name: "exclude order", change: func() { discoverExclude = []string{"10.0.0.1", "10.0.0.9"} }, same: true},
+		{name: "ports order", change: func() { discoverPorts = []int{5432, 6443} }, same: true},
+		{name: "rate", change: func() { discoverRate = 10 }, same: true}, // 只影响扫描速度
+		{name: "exclude", change: func() { discoverExclude = nil }},
+		{name: "ssh port", change: func() { discoverPort = "2222" }},
+		{name: "ports", change: func() { discoverPorts = []int{5432} }},
+		{name: "fingerprint", change: func() { discoverFingerprint = true }},
+		{name: "timeout", change: func() { discoverTimeout = 5 * time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			tt.change()
+			if got := checkpointKey("prod", "10.0.0.0/24"); (got == base) != tt.same {
+				t.Errorf("key %q vs %q, want same %v", got, base, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/transfer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	noVerify      bool
+	verifyRetries int
+)
+
+// addVerifyFlags 注册校验相关的标志：传输默认校验，--no-verify 跳过
+func addVerifyFlags(cmd *cobra.Command, retriesScope string) {
+	cmd.Flags().BoolVar(&noVerify, "no-verify", false, "Skip verifying transferred files with SHA-256 on both ends")
+	cmd.Flags().IntVar(&verifyRetries, "retries", 0, "Retransfer files that fail verification up to this many times"+retriesScope)
+}
+
+// verifyTransfers 报告是否需要校验传输的文件
+func verifyTransfers() bool {
+	return !noVerify
+}
+
+// remoteChecksums 在节点上用 sha256sum 计算 root 下各个相对路径的 SHA-256
+// 路径以 NUL 分隔从 stdin 传入，文件名中的特殊字符不会经过 shell；
+// 无法计算的文件不会出现在结果中
+func remoteChecksums(cluster *config.Cluster, node *config.Node, root string, paths []string) (map[string]string, error) {
+	sums := map[string]string{}
+	if len(paths) == 0 {
+		return sums, nil
+	}
+	script := fmt.Sprintf("cd -- %s && xargs -0 sha256sum --", shellQuote(root))
+	sumCmd, err := remoteTarget{cluster: cluster, node: node}.command(script)
+	if err != nil {
+		return nil, err
+	}
+	var stdin strings.Builder
+	for _, p := range paths {
+		stdin.WriteString(p)
+		stdin.WriteByte(0)
+	}
+	sumCmd.Stdin = strings.NewReader(stdin.String())
+	stderr := &syncBuffer{}
+	sumCmd.Stderr = stderr
+	out, err := sumCmd.Output()
+	if err != nil {
+		// 部分文件不可读时 sha256sum 以 1 退出，其余文件的结果仍然可用
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 || len(out) == 0 {
+			return nil, fmt.Errorf("computing checksums on %s: %v: %s", node.Alias, err, stderr.String())
+		}
+	}
+
+	return parseChecksums(string(out)), nil
+}
+
+// parseChecksums 解析 sha256sum 的输出，返回文件名到 SHA-256 的映射
+// 文件名中包含反斜杠、换行或回车时，sha256sum 会在行首加上 \ 并把它们转义为 \\、\n 和 \r
+func parseChecksums(out string) map[string]string {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line, escaped := strings.CutPrefix(scanner.Text(), `\`)
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok {
+			continue
+		}
+		if escaped {
+			if name, ok = unescapeChecksumName(name); !ok {
+				continue
+			}
+		}
+		sums[path.Clean(name)] = sum
+	}
+	return sums
+}
+
+// unescapeChecksumName 还原 sha256sum 转义过的文件名，遇到无法识别的转义时返回 false
+func unescapeChecksumName(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return "", false
+		}
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// verifiedFile 是一个已经传输完成、等待校验的文件，sum 是传输过程中计算的 SHA-256
+type verifiedFile struct {
+	src, dst, sum string
+}
+
+// transferVerifier 收集传输完成的文件，传输结束后在节点上计算 SHA-256 与之比较
+type transferVerifier struct {
+	target      remoteTarget
+	remoteIsDst bool // 为 true 时校验 dst（上传），否则校验 src（下载）
+	mu          sync.Mutex
+	files       []verifiedFile
+}
+
+func newTransferVerifier(target remoteTarget, remoteIsDst bool) *transferVerifier {
+	return &transferVerifier{target: target, remoteIsDst: remoteIsDst}
+}
+
+// options 在需要校验时为传输选项加上记录文件的回调
+func (v *transferVerifier) options(opts transfer.Options) transfer.Options {
+	if verifyTransfers() {
+		opts.OnFile = v.record
+	}
+	return opts
+}
+
+func (v *transferVerifier) record(src, dst, sum string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.files = append(v.files, verifiedFile{src: src, dst: dst, sum: sum})
+}
+
+func (v *transferVerifier) remotePath(f verifiedFile) string {
+	if v.remoteIsDst {
+		return f.dst
+	}
+	return f.src
+}
+
+// mismatches 在节点上计算所有已记录文件的 SHA-256，返回与传输时不一致的文件
+func (v *transferVerifier) mismatches() ([]verifiedFile, error) {
+	paths := make([]string, len(v.files))
+	for i, f := range v.files {
+		paths[i] = v.remotePath(f)
+	}
+	sums, err := remoteChecksums(v.target.cluster, v.target.node, ".", paths)
+	if err != nil {
+		return nil, err
+	}
+	var bad []verifiedFile
+	for _, f := range v.files {
+		remote, ok := sums[path.Clean(v.remotePath(f))]
+		if !ok {
+			remote = "(unreadable)"
+		}
+		if remote != f.sum {
+			fmt.Fprintf(os.Stderr, "  ❌ %s: checksum mismatch for %s (transferred %s, remote %s)\n",
+				v.target, v.remotePath(f), shortSum(f.sum), shortSum(remote))
+			bad = append(bad, f)
+		}
+	}
+	return bad, nil
+}
+
+// verify 校验传输的文件，不一致的文件通过 retry 重新传输，最多重试 --retries 次
+// 指定 --no-verify 时直接返回
+func (v *transferVerifier) verify(retry func(f verifiedFile, opts transfer.Options) error) error {
+	if !verifyTransfers() {
+		return nil
+	}
+	count := len(v.files)
+	for attempt := 1; ; attempt++ {
+		bad, err := v.mismatches()
+		if err != nil {
+			return err
+		}
+		if len(bad) == 0 {
+			fmt.Printf("--> %s: verified %d file(s) with SHA-256\n", v.target, count)
+			return nil
+		}
+		if attempt > verifyRetries {
+			return fmt.Errorf("%d file(s) failed checksum verification", len(bad))
+		}
+
+		fmt.Printf("--> %s: retransferring %d file(s) (retry %d/%d)...\n", v.target, len(bad), attempt, verifyRetries)
+		v.files = nil
+		for _, f := range bad {
+			if err := retry(f, v.options(transfer.Options{Limiter: transferLimiter})); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func shortSum(sum string) string {
+	if len(sum) > 12 {
+		return sum[:12]
+	}
+	return sum
+}
+
+// localTreeChecksums 计算本地 dir 下 name（文件或目录）中所有普通文件的 SHA-256
+// 键为相对 name 的路径，name 本身是文件时键为 "."，这样源和目标名称不同时也可以直接比较
+func localTreeChecksums(dir, name string) (map[string]string, error) {
+	sums := map[string]string{}
+	root := filepath.Join(dir, name)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		sum, err := transfer.FileSHA256(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	return sums, err
+}
+
+// remoteTreeChecksums 在节点上计算 dir 下 name（文件或目录）中所有普通文件的 SHA-256，键与 localTreeChecksums 相同
+func remoteTreeChecksums(cluster *config.Cluster, node *config.Node, dir, name string) (map[string]string, error) {
+	script := fmt.Sprintf("cd -- %s && find %s -type f -print0", shellQuote(dir), shellQuote(name))
+	findCmd, err := remoteTarget{cluster: cluster, node: node}.command(script)
+	if err != nil {
+		return nil, err
+	}
+	out, err := findCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing %s on %s: %w", path.Join(dir, name), node.Alias, err)
+	}
+	paths := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(out) == 0 {
+		paths = nil
+	}
+	sums, err := remoteChecksums(cluster, node, dir, paths)
+	if err != nil {
+		return nil, err
+	}
+	rel := map[string]string{}
+	for p, sum := range sums {
+		key := strings.TrimPrefix(strings.TrimPrefix(p, name), "/")
+		if key == "" {
+			key = "."
+		}
+		rel[key] = sum
+	}
+	return rel, nil
+}
+
+// compareTrees 检查 want 中的每个文件在 got 中都存在且校验和相同，用于无法逐个记录文件的 tar 传输
+// 目标目录中原本就有的其他文件不影响结果
+func compareTrees(label string, want, got map[string]string) error {
+	var bad []string
+	for p, sum := range want {
+		if got[p] != sum {
+			bad = append(bad, p)
+		}
+	}
+	sort.Strings(bad)
+	for _, p := range bad {
+		fmt.Fprintf(os.Stderr, "  ❌ %s: checksum mismatch for %s\n", label, p)
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%d file(s) failed checksum verification", len(bad))
+	}
+	fmt.Printf("--> %s: verified %d file(s) with SHA-256\n", label, len(want))
+	return nil
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseChecksums(t *testing.T) {
+	const a, b = "aaaa", "bbbb"
+	tests := []struct {
+		name string
+		out  string
+		want map[string]string
+	}{
+		{
+			name: "plain",
+			out:  a + "  ./x/file.txt\n" + b + "  y\n",
+			want: map[string]string{"x/file.txt": a, "y": b},
+		},
+		{
+			name: "name with spaces",
+			out:  a + "  my  file\n",
+			want: map[string]string{"my  file": a},
+		},
+		{
+			name: "escaped backslash",
+			out:  `\` + a + `  dir\\name` + "\n",
+			want: map[string]string{`dir\name`: a},
+		},
+		{
+			name: "escaped newline and carriage return",
+			out:  `\` + a + `  line1\nline2\r` + "\n",
+			want: map[string]string{"line1\nline2\r": a},
+		},
+		{
+			name: "unknown escape skipped",
+			out:  `\` + a + `  bad\x` + "\n" + b + "  ok\n",
+			want: map[string]string{"ok": b},
+		},
+		{
+			name: "trailing backslash skipped",
+			out:  `\` + a + `  bad\` + "\n",
+			want: map[string]string{},
+		},
+		{
+			name: "garbage",
+			out:  "sha256sum: missing: No such file or directory\n",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseChecksums(tt.out); !maps.Equal(got, tt.want) {
+				t.Errorf("parseChecksums = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// completionCacheTTL 是远端目录列表的缓存时间，连续按 Tab 时不必每次都经由跳板机连接节点
+	completionCacheTTL = 30 * time.Second
+	// completionTimeout 是补全时列出远端目录的最长等待时间
+	completionTimeout = 5 * time.Second
+)
+
+// completeNodeAlias 补全第一个参数的节点别名，说明中显示 IP 和所属集群
+func completeNodeAlias(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return nodeAliases(toComplete, ""), cobra.ShellCompDirectiveNoFileComp
+}
+
+// nodeAliases 返回以 prefix 开头的节点别名（加上 suffix），附带 cobra 的说明文字
+func nodeAliases(prefix, suffix string) []string {
+	if cfg == nil {
+		return nil
+	}
+	var aliases []string
+	for _, cluster := range cfg.Clusters {
+		for _, node := range cluster.Nodes {
+			if strings.HasPrefix(node.Alias, prefix) {
+				aliases = append(aliases, fmt.Sprintf("%s%s\t%s (%s)", node.Alias, suffix, node.IP, cluster.Name))
+			}
+		}
+	}
+	return aliases
+}
+
+// completeClusterName 补全 --cluster 参数
+func completeClusterName(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if cfg == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, cluster := range cfg.Clusters {
+		if strings.HasPrefix(cluster.Name, toComplete) {
+			names = append(names, fmt.Sprintf("%s\tbastion %s", cluster.Name, cluster.Bastion.Host))
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// registerClusterCompletions 为命令树中所有名为 --cluster 的参数注册集群名补全
+func registerClusterCompletions(cmd *cobra.Command) {
+	if cmd.Flags().Lookup("cluster") != nil {
+		cmd.RegisterFlagCompletionFunc("cluster", completeClusterName)
+	}
+	for _, sub := range cmd.Commands() {
+		registerClusterCompletions(sub)
+	}
+}
+
+// completeTransferArg 补全 scp/sync 的参数：本地路径和节点别名，以及 alias: 之后的远端路径
+func completeTransferArg(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) >= 2 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	alias, remote, isRemote := parseScpArg(toComplete)
+	if !isRemote {
+		if strings.ContainsAny(toComplete, "/~") || strings.HasPrefix(toComplete, ".") {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		// 既可能是本地文件也可能是节点别名，两者都列出
+		candidates := append(nodeAliases(toComplete, ":"), localEntries(toComplete)...)
+		return candidates, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+	}
+	if isNodeSelector(alias) {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	// parseScpArg 把 "alias:" 当作家目录 "."，补全时应当列出家目录而不是加上 ./ 前缀
+	if strings.HasSuffix(toComplete, ":") {
+		remote = ""
+	}
+	dir, prefix := "", remote
+	if i := strings.LastIndex(remote, "/"); i >= 0 {
+		dir, prefix = remote[:i+1], remote[i+1:]
+	}
+	names, err := remoteEntries(alias, dir)
+	if err != nil {
+		cobra.CompDebugln(err.Error(), true)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var candidates []string
+	for _, name := range names {
+		if name != "" && strings.HasPrefix(name, prefix) && (strings.HasPrefix(prefix, ".") || !strings.HasPrefix(name, ".")) {
+			candidates = append(candidates, alias+":"+dir+name)
+		}
+	}
+	return candidates, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+}
+
+// localEntries 列出当前目录中以 prefix 开头的文件，目录以 / 结尾
+func localEntries(prefix string) []string {
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) || (strings.HasPrefix(e.Name(), ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		if e.IsDir() {
+			names = append(names, e.Name()+"/")
+		} else {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// remoteEntries 经由跳板机列出节点上 dir 目录中的条目，目录以 / 结尾；结果会缓存一小段时间
+// 主机密钥尚未固定的节点不会连接（nodeCommand 返回错误），补全过程中不会固定密钥或提示输入
+func remoteEntries(alias, dir string) ([]string, error) {
+	node, cluster, err := cfg.FindNode(alias)
+	if err != nil {
+		return nil, err
+	}
+	if !connectsWithoutPrompt(cluster) {
+		return nil, fmt.Errorf("connecting to cluster '%s' needs a passphrase or a new certificate", cluster.Name)
+	}
+	cachePath, err := completionCachePath(node.Alias, dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(cachePath); err == nil && time.Since(info.ModTime()) < completionCacheTTL {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+		}
+	}
+
+	script := "ls -1Ap"
+	if dir != "" {
+		script = fmt.Sprintf("cd -- %s && ls -1Ap", shellQuote(sftpPath(dir)))
+	}
+	batch := []string{"-o", "BatchMode=yes"}
+	remote, err := nodeCommand(cluster, node, batch, shellQuote(script))
+	if err != nil {
+		return nil, err
+	}
+	listCmd, err := sshCommand(cluster, batch, remote)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	listCmd.Stdout = &out
+	if err := listCmd.Start(); err != nil {
+		return nil, err
+	}
+	timer := time.AfterFunc(completionTimeout, func() { listCmd.Process.Kill() })
+	err = listCmd.Wait()
+	timer.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("listing %s on %s: %w", dir, node.Alias, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err == nil {
+		os.WriteFile(cachePath, out.Bytes(), 0600)
+	}
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"), nil
+}
+
+func completionCachePath(alias, dir string) (string, error) {
+	base, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(alias + ":" + dir))
+	return filepath.Join(base, "cache", "complete-"+hex.EncodeToString(sum[:8])), nil
+}
+
+// connectsWithoutPrompt 报告连接集群时是否不需要任何交互。补全的输出被 shell 捕获，
+// 提示输入主口令或用 CA 签发证书（CA 私钥可能有口令）时用户看不到提示，Tab 会一直卡住，
+// 因此只在有可复用的证书、或者跳板机口令不需要交互就能解密时才连接
+func connectsWithoutPrompt(cluster *config.Cluster) bool {
+	if cluster.Certificate != nil {
+		return cachedCertificate(cluster) != nil
+	}
+	if _, ok := cluster.Secrets[secretBastionPassphrase]; ok {
+		return masterKeyAvailable()
+	}
+	return true
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 
 	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/inventory"
+	"github.com/gitlayzer/kgate/internal/sshkey"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 )
@@ -26,6 +28,12 @@ var configListCmd = &cobra.Command{
 		fmt.Println("Configured Clusters:")
 		for _, cluster := range cfg.Clusters {
 			fmt.Printf("- %s (Bastion: %s@%s)\n", cluster.Name, cluster.Bastion.User, cluster.Bastion.Host)
+			if cluster.Bastion.AgentKey != "" {
+				fmt.Printf("    agent key: %s\n", cluster.Bastion.AgentKey)
+			}
+			if cluster.Bastion.ForwardAgent {
+				fmt.Println("    ⚠️  agent forwarding: enabled")
+			}
 		}
 	},
 }
@@ -123,8 +131,146 @@ var configRemoveCmd = &cobra.Command{
 	},
 }
 
+var configAgentKeysCmd = &cobra.Command{
+	Use:   "agent-keys",
+	Short: "List keys loaded in ssh-agent with the fingerprints used by 'agentKey'",
+	Run: func(cmd *cobra.Command, args []string) {
+		keys, err := sshkey.AgentKeys()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if len(keys) == 0 {
+			fmt.Println("The ssh-agent has no keys loaded. Use 'ssh-add' to add one.")
+			return
+		}
+		fmt.Println("Keys in ssh-agent:")
+		for _, key := range keys {
+			fmt.Printf("- %s %s (%s)\n", key.Fingerprint(), key.Comment, key.Type)
+		}
+	},
+}
+
+var (
+	inventoryRemote  string
+	inventoryBranch  string
+	inventoryFile    string
+	inventoryPush    bool
+	inventoryCluster string
+)
+
+var configSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync clusters and nodes with a shared git inventory",
+	Long: `Pulls the team inventory from a git remote and merges it into your personal config.
+Entries that already exist locally are kept; differences are reported node by node.
+With --push, nodes that only exist locally (e.g. added by 'kgate nodes discover') are
+committed back to the inventory.`,
+	Run: runConfigSync,
+}
+
+func runConfigSync(cmd *cobra.Command, args []string) {
+	if cfg.Inventory == nil {
+		cfg.Inventory = &config.Inventory{}
+	}
+	if inventoryRemote != "" {
+		cfg.Inventory.Remote = inventoryRemote
+	}
+	if inventoryBranch != "" {
+		cfg.Inventory.Branch = inventoryBranch
+	}
+	if inventoryFile != "" {
+		cfg.Inventory.File = inventoryFile
+	}
+	if cfg.Inventory.Remote == "" {
+		fmt.Fprintln(os.Stderr, "Error: no inventory remote configured, use --remote to set one")
+		os.Exit(1)
+	}
+
+	repo, err := inventory.Open(cfg.Inventory)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if err := repo.Pull(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	team, err := repo.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	res := inventory.Merge(cfg, team)
+	fmt.Printf("--> Pulled %d cluster(s) and %d node(s) from %s\n", res.AddedClusters, res.AddedNodes, cfg.Inventory.Remote)
+	if len(res.Conflicts) > 0 {
+		fmt.Printf("⚠️  %d conflict(s), keeping local values:\n", len(res.Conflicts))
+		for _, c := range res.Conflicts {
+			fmt.Println("  - " + c.String())
+		}
+	}
+
+	// 先保存拉取的结果，推送失败时不会丢失
+	if err := cfg.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save config: %v\n", err)
+		return
+	}
+
+	if inventoryPush {
+		pushInventory(repo)
+	}
+	fmt.Println("✅ Inventory synced successfully.")
+}
+
+// pushInventory 将本地新增的节点提交到团队清单，推送被拒绝时会重新拉取并重试一次
+func pushInventory(repo *inventory.Repo) {
+	for attempt := 0; ; attempt++ {
+		team, err := repo.Load()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		res := inventory.Publish(cfg, team, inventoryCluster)
+		if len(res.Conflicts) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: %d conflict(s) with the inventory, resolve them before pushing:\n", len(res.Conflicts))
+			for _, c := range res.Conflicts {
+				fmt.Fprintln(os.Stderr, "  - "+c.String())
+			}
+			os.Exit(1)
+		}
+		if res.AddedClusters == 0 && res.AddedNodes == 0 {
+			fmt.Println("--> Nothing to push.")
+			return
+		}
+		message := fmt.Sprintf("Add %d node(s) via kgate config sync", res.AddedNodes)
+		err = repo.Commit(team, message)
+		if err == nil {
+			fmt.Printf("--> Pushed %d cluster(s) and %d node(s) to %s\n", res.AddedClusters, res.AddedNodes, cfg.Inventory.Remote)
+			return
+		}
+		if attempt > 0 {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		// 远端在此期间有新的提交，重新拉取后再试一次
+		if err := repo.Pull(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+}
+
 func init() {
+	configSyncCmd.Flags().StringVar(&inventoryRemote, "remote", "", "Git remote of the team inventory (saved to config)")
+	configSyncCmd.Flags().StringVar(&inventoryBranch, "branch", "", "Branch of the team inventory (default \"main\")")
+	configSyncCmd.Flags().StringVar(&inventoryFile, "file", "", "Inventory file inside the repository (default \"inventory.yaml\")")
+	configSyncCmd.Flags().BoolVar(&inventoryPush, "push", false, "Commit locally added nodes back to the inventory")
+	configSyncCmd.Flags().StringVar(&inventoryCluster, "cluster", "", "Only push this cluster (publishes it if it is not in the inventory yet)")
+
 	configCmd.AddCommand(configListCmd)
 	configCmd.AddCommand(configAddCmd)
 	configCmd.AddCommand(configRemoveCmd)
+	configCmd.AddCommand(configSyncCmd)
+	configCmd.AddCommand(configAgentKeysCmd)
 }
@@ -1,11 +1,11 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"strings"
 
+	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
@@ -13,47 +13,64 @@ import (
 var connectCmd = &cobra.Command{
 	Use:   "connect [node-alias]",
 	Short: "Connect to a node via its bastion using an interactive SSH session",
-	Args:  cobra.ExactArgs(1),
-	Run:   runConnect,
+	Long: `Connect to a node via its bastion using an interactive SSH session.
+
+Without an argument, or with a partial one that is not an exact alias, an
+interactive picker lists the nodes of all clusters. Type to fuzzy-search by
+alias, IP, cluster or labels; recently used nodes are listed first. A partial
+argument pre-filters the picker; it asks for confirmation even when only one
+node matches, so a mistyped alias never connects to an unrelated node.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runConnect,
+
+	ValidArgsFunction: completeNodeAlias,
 }
 
 func runConnect(cmd *cobra.Command, args []string) {
-	nodeAlias := args[0]
+	query := ""
+	if len(args) > 0 {
+		query = args[0]
+	}
 
-	node, cluster, err := cfg.FindNode(nodeAlias)
+	node, cluster, err := resolveNode(query)
+	if errors.Is(err, promptui.ErrInterrupt) || errors.Is(err, promptui.ErrEOF) {
+		os.Exit(1)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
+	recordRecentNode(node.Alias)
 
 	bastion := cluster.Bastion
-	bastionAddr := fmt.Sprintf("%s@%s", bastion.User, bastion.Host)
-	nodeAddr := fmt.Sprintf("%s@%s", node.User, node.IP)
 
 	fmt.Printf("--> Connecting to %s (%s) via bastion %s (%s) using bastion's key\n", node.Alias, node.IP, cluster.Name, bastion.Host)
 
+	if err := pinNodeKey(cluster, node); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 	innerSshArgs := []string{}
 	if term.IsTerminal(int(os.Stdin.Fd())) {
 		innerSshArgs = append(innerSshArgs, "-t")
 	}
-	innerSshArgs = append(innerSshArgs, nodeAddr, "/bin/bash", "-l")
-	remoteCommand := "ssh " + strings.Join(innerSshArgs, " ")
-
-	var outerSshArgs []string
-
-	outerSshArgs = append(outerSshArgs, "-t")
-
-	if bastion.IdentityFile != "" {
-		outerSshArgs = append(outerSshArgs, "-i", bastion.IdentityFile)
+	remoteCommand, err := nodeCommand(cluster, node, innerSshArgs, "/bin/bash -l")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
 	}
-	outerSshArgs = append(outerSshArgs, bastionAddr, remoteCommand)
 
-	sshCmd := exec.Command("ssh", outerSshArgs...)
+	sshCmd, err := sshCommand(cluster, []string{"-t"}, remoteCommand)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 	sshCmd.Stdin = os.Stdin
 	sshCmd.Stdout = os.Stdout
 	sshCmd.Stderr = os.Stderr
 
 	if err := sshCmd.Run(); err != nil {
+		checkNodeHostKey(cluster, node, err)
 		os.Exit(1)
 	}
 }
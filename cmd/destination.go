@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/transfer"
+)
+
+// pathStat 报告路径是否存在以及是否为目录
+type pathStat func(p string) (exists, isDir bool)
+
+func localStat(p string) (bool, bool) {
+	info, err := os.Stat(p)
+	return err == nil, err == nil && info.IsDir()
+}
+
+func sftpStat(client *transfer.Client) pathStat {
+	return func(p string) (bool, bool) {
+		info, err := client.Stat(p)
+		return err == nil, err == nil && info.IsDir()
+	}
+}
+
+// remoteStat 在节点上一次性检查多个路径，用于不经过 SFTP 的 tar 传输
+// 返回的 pathStat 只能查询 paths 中的路径，其他路径一律视为不存在
+func remoteStat(cluster *config.Cluster, node *config.Node, paths ...string) (pathStat, error) {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuote(p)
+	}
+	script := fmt.Sprintf(`for p in %s; do if [ -d "$p" ]; then echo d; elif [ -e "$p" ]; then echo f; else echo -; fi; done`,
+		strings.Join(quoted, " "))
+	statCmd, err := remoteTarget{cluster: cluster, node: node}.command(script)
+	if err != nil {
+		return nil, err
+	}
+	out, err := statCmd.Output()
+	if err != nil {
+		checkNodeHostKey(cluster, node, err)
+		return nil, fmt.Errorf("checking paths on %s: %w", node.Alias, err)
+	}
+	kinds := strings.Fields(string(out))
+	if len(kinds) != len(paths) {
+		return nil, fmt.Errorf("checking paths on %s: unexpected output %q", node.Alias, out)
+	}
+	found := map[string]string{}
+	for i, p := range paths {
+		found[p] = kinds[i]
+	}
+	return func(p string) (bool, bool) {
+		kind := found[p]
+		return kind == "d" || kind == "f", kind == "d"
+	}, nil
+}
+
+// copyMode 是决定哪些源可以复制、哪些目标可以覆盖的选项
+type copyMode struct {
+	recursive bool // 允许复制目录
+	force     bool // 允许覆盖已有文件
+	resume    bool // 允许覆盖旁边有对应 .kgate-part 临时文件的已有文件
+}
+
+// scpMode 返回 kgate scp 的 -r、--force 和 --resume 参数对应的 copyMode
+func scpMode() copyMode {
+	return copyMode{recursive: recursive, force: scpForce, resume: scpResume}
+}
+
+// resolveDestination 按 scp 的规则确定把名为 name 的源复制到 dest 后的最终路径：
+// dest 是已存在的目录时复制到其中，否则复制为 dest 本身，相当于复制的同时重命名。
+// multiple 表示有多个源，这时 dest 必须是已存在的目录。目录需要 mode.recursive，覆盖已有文件需要 mode.force；
+// mode.resume 只在目标旁边有对应的 .kgate-part 临时文件时才允许覆盖，即继续一次被中断的覆盖
+func resolveDestination(stat pathStat, join func(...string) string, dir func(string) string, dest, name string, srcIsDir, multiple bool, mode copyMode) (string, error) {
+	if srcIsDir && !mode.recursive {
+		return "", fmt.Errorf("%s: is a directory (use -r to copy directories)", name)
+	}
+	exists, isDir := stat(dest)
+	final := dest
+	switch {
+	case isDir:
+		final = join(dest, name)
+	case multiple:
+		return "", fmt.Errorf("%s: not a directory", dest)
+	case exists && srcIsDir:
+		return "", fmt.Errorf("%s: cannot overwrite non-directory with directory %s", dest, name)
+	case !exists && strings.HasSuffix(dest, "/"):
+		return "", fmt.Errorf("%s: no such directory", dest)
+	case !exists:
+		if _, parentIsDir := stat(dir(dest)); !parentIsDir {
+			return "", fmt.Errorf("%s: no such directory", dir(dest))
+		}
+	}
+	if exists, _ := stat(final); exists && !mode.force {
+		if !mode.resume || srcIsDir {
+			return "", fmt.Errorf("%s already exists (use --force to overwrite)", final)
+		}
+		if partial, _ := stat(final + transfer.PartSuffix); !partial {
+			return "", fmt.Errorf("%s already exists and has no partial transfer to resume (use --force to overwrite)", final)
+		}
+	}
+	return final, nil
+}
+
+// expandRemote 展开远端路径中的通配符，没有通配符时原样返回
+func expandRemote(client *transfer.Client, pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+	matches, err := client.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%s: no matches", pattern)
+	}
+	return matches, nil
+}
+
+// remoteSource 是一个待下载或复制的远端源及其在目标端的最终路径
+type remoteSource struct {
+	path  string
+	final string
+	size  int64
+}
+
+// planRemoteSources 展开远端源中的通配符，并为每个源确定目标路径和大小
+func planRemoteSources(client *transfer.Client, pattern string, stat pathStat, join func(...string) string, dir func(string) string, dest string, mode copyMode) ([]remoteSource, error) {
+	paths, err := expandRemote(client, pattern)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]remoteSource, len(paths))
+	for i, p := range paths {
+		// 通配符展开的结果来自服务端，名称不能把目标路径带到目标目录之外
+		if p != pattern && !transfer.ValidName(path.Base(p)) {
+			return nil, fmt.Errorf("%w: %q", transfer.ErrUnsafePath, p)
+		}
+		info, err := client.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		final, err := resolveDestination(stat, join, dir, dest, path.Base(p), info.IsDir(), len(paths) > 1, mode)
+		if err != nil {
+			return nil, err
+		}
+		size, err := client.RemoteSize(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		sources[i] = remoteSource{path: p, final: final, size: size}
+	}
+	return sources, nil
+}
+
+// unpackScript 返回在节点上把 stdin 中的 tar 包（顶层条目为 name）解包为 final 的 shell 命令，按 --compress 先解压
+// 名称不变时直接解包到上级目录；需要重命名时先解包到同一目录下的临时目录再移动到位
+func unpackScript(name, final string) string {
+	parent := path.Dir(final)
+	if path.Base(final) == name {
+		return compressedPipeline("tar xf - -C "+shellQuote(parent), false)
+	}
+	return fmt.Sprintf(`tmp=$(mktemp -d %s/.kgate-XXXXXX) || exit 1; %s && rm -rf %s && mv "$tmp"/%s %s; rc=$?; rm -rf "$tmp"; exit $rc`,
+		shellQuote(parent), compressedPipeline(`tar xf - -C "$tmp"`, false), shellQuote(final), shellQuote(name), shellQuote(final))
+}
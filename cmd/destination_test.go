@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestResolveDestination(t *testing.T) {
+	// fs 描述远端已有的路径：true 为目录，false 为文件
+	fs := map[string]bool{
+		"/":                       true,
+		"/opt":                    true,
+		"/opt/app.jar":            false,
+		"/opt/old.jar":            false,
+		"/opt/old.jar.kgate-part": false,
+		"/opt/conf":               true,
+		"/opt/conf/app.yaml":      false,
+		"/opt/data":               true,
+		"/opt/data/data":          true,
+	}
+	stat := func(p string) (bool, bool) {
+		isDir, ok := fs[path.Clean(p)]
+		return ok, isDir
+	}
+
+	tests := []struct {
+		name     string
+		dest     string
+		src      string
+		srcIsDir bool
+		multiple bool
+		mode     copyMode
+		want     string
+		wantErr  string
+	}{
+		{name: "into directory", dest: "/opt", src: "new.jar", want: "/opt/new.jar"},
+		{name: "into directory with slash", dest: "/opt/", src: "new.jar", want: "/opt/new.jar"},
+		{name: "rename", dest: "/opt/renamed.jar", src: "new.jar", want: "/opt/renamed.jar"},
+		{name: "missing parent", dest: "/srv/app/x.jar", src: "new.jar", wantErr: "/srv/app: no such directory"},
+		{name: "missing directory with slash", dest: "/srv/", src: "new.jar", wantErr: "/srv/: no such directory"},
+		{name: "multiple into file", dest: "/opt/app.jar", src: "a", multiple: true, wantErr: "not a directory"},
+		{name: "directory without -r", dest: "/opt", src: "conf", srcIsDir: true, wantErr: "use -r"},
+		{name: "directory over file", dest: "/opt/app.jar", src: "conf", srcIsDir: true, mode: copyMode{recursive: true}, wantErr: "cannot overwrite non-directory"},
+		{name: "new directory", dest: "/opt/conf2", src: "conf", srcIsDir: true, mode: copyMode{recursive: true}, want: "/opt/conf2"},
+		{name: "existing file", dest: "/opt", src: "app.jar", wantErr: "already exists (use --force"},
+		{name: "existing file with force", dest: "/opt/app.jar", src: "app.jar", mode: copyMode{force: true}, want: "/opt/app.jar"},
+		{name: "resume without partial", dest: "/opt", src: "app.jar", mode: copyMode{resume: true}, wantErr: "no partial transfer"},
+		{name: "resume with partial", dest: "/opt", src: "old.jar", mode: copyMode{resume: true}, want: "/opt/old.jar"},
+		{name: "resume into existing directory", dest: "/opt", src: "conf", srcIsDir: true, mode: copyMode{recursive: true, resume: true}, wantErr: "already exists (use --force"},
+		{name: "existing directory with force", dest: "/opt/data", src: "data", srcIsDir: true, mode: copyMode{recursive: true, force: true}, want: "/opt/data/data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveDestination(stat, path.Join, path.Dir, tt.dest, tt.src, tt.srcIsDir, tt.multiple, tt.mode)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveDestination = %q, %v; want error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveDestination = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,26 +2,151 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
-	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
+	"text/template"
 	"time"
+	"unicode"
 
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/facts"
+	"github.com/gitlayzer/kgate/internal/hostkeys"
+	"github.com/gitlayzer/kgate/internal/scan"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/net/proxy"
 )
 
 var (
-	discoverRange       string
-	discoverPort        string = "22"
-	discoverWorkers     int    = 100
-	discoverDefaultUser string
+	discoverRange        []string
+	discoverExclude      []string
+	discoverTargetsFiles []string
+	discoverPort         string = "22"
+	discoverWorkers      int    = 100
+	discoverDefaultUser  string
+	discoverProxyTimeout time.Duration
+	discoverFingerprint  bool
+	discoverFacts        bool
+	discoverYes          bool
+	discoverDryRun       bool
+	discoverAliasTmpl    string
+	discoverLabels       map[string]string
+	discoverMarkStale    bool
+	discoverPrune        bool
+	discoverStrategy     string
+	discoverRate         int
+	discoverPorts        []int
+	discoverTimeout      time.Duration
+	discoverResume       bool
 )
 
+// discoveredHost 是一个确认运行着 SSH 服务的主机
+type discoveredHost struct {
+	IP          string
+	Banner      *scan.Banner
+	Fingerprint string
+	Facts       map[string]string // 开启 --facts 时登录主机收集到的信息
+	Services    []scan.Service    // --ports 指定的端口上识别出的服务
+}
+
+// aliasData 是别名模板中可以引用的字段
+type aliasData struct {
+	Hostname  string
+	Cluster   string
+	IP        string
+	LastOctet string
+	Labels    map[string]string
+}
+
+// parseAliasTemplate 解析别名模板，text 为空时使用默认模板：
+// 有主机名时使用主机名，否则使用 node-<ip>
+func parseAliasTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = `{{if .Hostname}}{{.Hostname}}{{else}}node-{{.IP}}{{end}}`
+	}
+	tmpl, err := template.New("alias").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("解析别名模板时出错: %w", err)
+	}
+	return tmpl, nil
+}
+
+// proposeAlias 根据模板为主机生成建议的别名
+// 生成结果为空或与已有节点重名时，分别回退到 node-<ip> 或追加数字后缀
+func proposeAlias(tmpl *template.Template, cluster *config.Cluster, host discoveredHost, taken map[string]bool) string {
+	data := aliasData{
+		Hostname:  host.Facts["hostname"],
+		Cluster:   cluster.Name,
+		IP:        host.IP,
+		LastOctet: host.IP[strings.LastIndexAny(host.IP, ".:")+1:],
+		Labels:    host.Facts,
+	}
+	var buf strings.Builder
+	alias := ""
+	if err := tmpl.Execute(&buf, data); err == nil {
+		alias = strings.Join(strings.Fields(buf.String()), "-")
+	}
+	if alias == "" {
+		alias = "node-" + host.IP
+	}
+
+	if !aliasTaken(alias, taken) {
+		return alias
+	}
+	for i := 2; ; i++ {
+		if candidate := fmt.Sprintf("%s-%d", alias, i); !aliasTaken(candidate, taken) {
+			return candidate
+		}
+	}
+}
+
+// aliasTaken 报告别名是否已被配置中的节点或本次将要添加的节点（taken）使用
+func aliasTaken(alias string, taken map[string]bool) bool {
+	_, _, err := cfg.FindNode(alias)
+	return err == nil || taken[alias]
+}
+
+// validateAlias 检查交互输入的别名：不能为空、不能含有空白或 scp 用来分隔路径的冒号，也不能与已有的别名重复
+func validateAlias(alias string, taken map[string]bool) error {
+	switch {
+	case alias == "":
+		return errors.New("别名不能为空")
+	case strings.ContainsFunc(alias, unicode.IsSpace) || strings.Contains(alias, ":"):
+		return errors.New("别名不能包含空白或冒号")
+	case aliasTaken(alias, taken):
+		return fmt.Errorf("别名 '%s' 已被使用", alias)
+	}
+	return nil
+}
+
+// collectFacts 通过跳板机登录每台主机收集信息，失败的主机只打印警告
+func collectFacts(cluster *config.Cluster, hosts []discoveredHost, user string) {
+	fmt.Printf("\n--> 正在登录 %d 台主机收集主机信息...\n", len(hosts))
+	targets := make([]remoteTarget, len(hosts))
+	for i, host := range hosts {
+		targets[i] = remoteTarget{cluster: cluster, node: &config.Node{Alias: host.IP, IP: host.IP, User: user}}
+	}
+	for i, res := range runOnTargets(targets, func(remoteTarget) string { return facts.Script }) {
+		if res.err != nil {
+			fmt.Fprintf(os.Stderr, "  ⚠️  %s: 收集信息失败: %s\n", hosts[i].IP, targetError(res))
+			continue
+		}
+		f := facts.Parse(res.stdout)
+		hosts[i].Facts = f
+		fmt.Printf("  - %-15s %s, %s, %s CPU, %s 内存\n", hosts[i].IP, f["hostname"], f["os"], f["cpus"], f["memory"])
+	}
+}
+
 var discoverCmd = &cobra.Command{
 	Use:   "discover",
 	Short: "Discover nodes within the network through springboard machines",
@@ -31,196 +156,726 @@ This operation protects the performance of the springboard by running a scanner
 }
 
 func init() {
-	discoverCmd.Flags().StringVarP(&discoverRange, "range", "r", "", "IP range of CIDR format to scan (for example, 192.168.1.0/24)")
+	discoverCmd.Flags().StringSliceVarP(&discoverRange, "range", "r", nil, "IP ranges to scan: CIDR (192.168.1.0/24, fd00::/120), dash range (10.0.0.10-10.0.0.80) or single address; repeatable")
+	discoverCmd.Flags().StringSliceVarP(&discoverExclude, "exclude", "x", nil, "IP ranges to skip, in the same formats as --range; repeatable")
+	discoverCmd.Flags().StringSliceVarP(&discoverTargetsFiles, "targets-file", "f", nil, "File with one range or address per line to scan; repeatable")
 	discoverCmd.Flags().StringVarP(&discoverPort, "port", "p", "22", "SSH port to scan")
 	discoverCmd.Flags().IntVarP(&discoverWorkers, "workers", "w", 100, "Number of worker threads for concurrent scans")
 	discoverCmd.Flags().StringVarP(&discoverDefaultUser, "default-user", "u", "", "Set a default username for all newly discovered hosts to skip interactive prompts")
-	discoverCmd.MarkFlagRequired("range")
+	discoverCmd.Flags().DurationVar(&discoverProxyTimeout, "proxy-timeout", 30*time.Second, "How long to wait for the SOCKS proxy through the bastion to become ready")
+	discoverCmd.Flags().BoolVar(&discoverFingerprint, "fingerprint", false, "Also perform a key exchange with each host to show its host key fingerprint")
+	discoverCmd.Flags().BoolVar(&discoverFacts, "facts", false, "Log in to each new host through the bastion to collect hostname, OS, CPU/memory and interfaces as labels and alias hints")
+	addParallelFlag(discoverCmd)
+	discoverCmd.Flags().BoolVarP(&discoverYes, "yes", "y", false, "Add all discovered hosts without prompting, using --default-user (or root) and generated aliases")
+	discoverCmd.Flags().BoolVar(&discoverDryRun, "dry-run", false, "Only print the nodes that would be added, without prompting or saving")
+	discoverCmd.Flags().StringVar(&discoverAliasTmpl, "alias-template", "", "Template for generated aliases, e.g. '{{.Cluster}}-{{.LastOctet}}' (overrides the cluster's aliasTemplate)")
+	discoverCmd.Flags().StringToStringVar(&discoverLabels, "labels", nil, "Labels to set on every added node, e.g. env=prod,role=web")
+	discoverCmd.Flags().BoolVar(&discoverMarkStale, "mark-stale", false, "Mark configured nodes in the scanned range that no longer respond as stale, and record when responding nodes were last seen")
+	discoverCmd.Flags().BoolVar(&discoverPrune, "prune", false, "Remove configured nodes in the scanned range that were already marked stale and still do not respond; nodes missing for the first time are only marked stale (asks for confirmation unless --yes)")
+	discoverCmd.Flags().StringVar(&discoverStrategy, "strategy", "socks", "Where to run the scan: socks (locally, through a SOCKS proxy on the bastion) or remote (on the bastion itself, using nmap if installed)")
+	discoverCmd.Flags().IntVar(&discoverRate, "rate", 200, "Maximum probe packets per second, one per connection attempt, for both strategies (0 for unlimited)")
+	discoverCmd.Flags().DurationVar(&discoverTimeout, "timeout", 2*time.Second, "Connect timeout for each probe")
+	discoverCmd.Flags().BoolVar(&discoverResume, "resume", false, "Resume an interrupted scan with the same parameters from its checkpoint (socks strategy only)")
+	discoverCmd.Flags().IntSliceVar(&discoverPorts, "ports", nil, "Additional service ports to fingerprint, e.g. 5432,6379,6443; found services are recorded in the forwards list of their node (socks strategy only)")
+	discoverCmd.Flags().String("cluster", "", "The name of the cluster")
+	discoverCmd.MarkFlagsOneRequired("range", "targets-file")
+	discoverCmd.MarkFlagRequired("cluster")
+}
+
+// scanViaSocks 启动经由跳板机的 SOCKS 代理，在本地完成扫描后关闭代理
+func scanViaSocks(ctx context.Context, cluster *config.Cluster, targets *scan.Targets) ([]discoveredHost, int, error) {
+	fmt.Println("--> 正在通过跳板机启动 SSH SOCKS 代理...")
+	socks, err := startSocksProxy(ctx, cluster, discoverProxyTimeout)
+	if err != nil {
+		return nil, 0, fmt.Errorf("启动 SSH 代理时出错: %w", err)
+	}
+	fmt.Printf("--> SSH SOCKS 代理已在 %s 上就绪\n", socks.Addr)
+
+	found, skipped, err := scanHosts(ctx, socks.Addr, cluster, targets)
+
+	// 扫描结束（或被取消）后立即关闭代理，后续的交互不再需要它
+	fmt.Println("\n--> 正在关闭 SSH SOCKS 代理...")
+	if closeErr := socks.Close(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "关闭代理进程组时出错: %v\n", closeErr)
+	} else {
+		fmt.Println("--> 代理已关闭。")
+	}
+	return found, skipped, err
+}
+
+// scanJob 是一个待扫描的地址及其在扫描顺序中的位置
+type scanJob struct {
+	index uint64
+	ip    netip.Addr
+}
+
+// scanHosts 通过 SOCKS 代理并发探测目标端口，返回发送了 SSH 协议标识的主机
+// 端口开放但没有 SSH 标识的响应者（例如中间设备）会被过滤掉并计入 skipped
+// 扫描进度会定期写入检查点，被中断后可以通过 --resume 从检查点继续
+func scanHosts(ctx context.Context, proxyAddr string, cluster *config.Cluster, targets *scan.Targets) (hosts []discoveredHost, skipped int, err error) {
+	// 设置 SOCKS5 拨号器
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, proxy.Direct)
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建 SOCKS5 拨号器时出错: %w", err)
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, 0, errors.New("拨号器不支持 context。")
+	}
+	// --rate 限制每秒发出的探测包数：每次连接尝试发出一个 SYN，计一次；
+	// 限制的是连接而不是主机，开启 --fingerprint 或 --ports 时每个主机需要多个连接
+	limiter := scan.NewLimiter(discoverRate)
+	defer limiter.Stop()
+	probe := &probeDialer{dialer: contextDialer, limiter: limiter}
+
+	cp, err := loadCheckpoint(cluster, targets)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !discoverResume {
+		if cp.Exists() {
+			fmt.Println("--> 已忽略上次未完成的扫描检查点，使用 --resume 可以从中断处继续。")
+		}
+		cp.Done, cp.Skipped, cp.Hosts = 0, 0, nil
+	} else if cp.Done > 0 {
+		fmt.Printf("--> 从检查点恢复：已完成 %d 个地址，发现 %d 个主机\n", cp.Done, len(cp.Hosts))
+	}
+
+	// 并发扫描
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		// 乱序完成的地址先记在 completed 中，watermark 之前的地址均已完成
+		watermark = cp.Done
+		completed = make(map[uint64]bool)
+		pending   []discoveredHost // 尚未被 watermark 覆盖的结果
+		pendingAt []uint64
+	)
+	hosts, skipped = cp.Hosts, cp.Skipped
+	jobs := make(chan scanJob, discoverWorkers)
+	total := targets.Count()
+
+	fmt.Printf("--> 正在扫描 %s 中的 %d 个主机，查找开放的端口 %s...\n", targets, total, discoverPort)
+	progress := startProgress(total, cp.Done, uint64(len(hosts)))
+
+	// complete 记录一个地址的扫描结果，并推进 watermark；调用方需持有 mu
+	complete := func(index uint64, host *discoveredHost, notSSH bool) {
+		if notSSH {
+			skipped++
+		}
+		if host != nil {
+			pending = append(pending, *host)
+			pendingAt = append(pendingAt, index)
+			progress.found.Add(1)
+		}
+		completed[index] = true
+		for completed[watermark] {
+			delete(completed, watermark)
+			watermark++
+		}
+		progress.done.Add(1)
+	}
+	// saveCheckpoint 将 watermark 之前的结果写入检查点；调用方需持有 mu
+	saveCheckpoint := func() error {
+		var rest []discoveredHost
+		var restAt []uint64
+		for i, h := range pending {
+			if pendingAt[i] < watermark {
+				hosts = append(hosts, h)
+			} else {
+				rest = append(rest, h)
+				restAt = append(restAt, pendingAt[i])
+			}
+		}
+		pending, pendingAt = rest, restAt
+		cp.Done, cp.Skipped, cp.Hosts = watermark, skipped, hosts
+		return cp.Save()
+	}
+
+	for i := 0; i < discoverWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				target := net.JoinHostPort(job.ip.String(), discoverPort)
+				host, err := probeHost(ctx, probe, target)
+				services := probeServices(ctx, probe, job.ip)
+				if ctx.Err() != nil {
+					// 被取消时探测结果不可靠，不记录该地址，恢复时会重新扫描
+					continue
+				}
+				mu.Lock()
+				switch {
+				case err != nil && len(services) == 0:
+					complete(job.index, nil, errors.Is(err, scan.ErrNotSSH))
+				default:
+					if err != nil {
+						// 没有 SSH 服务但开放了其他端口，只报告服务，不会作为节点添加
+						host = &discoveredHost{}
+					}
+					host.IP = job.ip.String()
+					host.Services = services
+					complete(job.index, host, false)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// 定期保存检查点
+	saveDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mu.Lock()
+				saveCheckpoint()
+				mu.Unlock()
+			case <-saveDone:
+				return
+			}
+		}
+	}()
+
+	var index uint64
+feed:
+	for ip := range targets.All() {
+		if index < cp.Done {
+			index++
+			continue
+		}
+		select {
+		case jobs <- scanJob{index: index, ip: ip}:
+			index++
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(saveDone)
+	progress.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		if saveErr := saveCheckpoint(); saveErr != nil {
+			fmt.Fprintf(os.Stderr, "保存扫描检查点时出错: %v\n", saveErr)
+		} else {
+			fmt.Printf("\n--> 已保存扫描检查点 (%d/%d)，使用相同的参数加上 --resume 可以继续扫描。\n", watermark, total)
+		}
+		return nil, 0, err
+	}
+	if err := cp.Remove(); err != nil {
+		fmt.Fprintf(os.Stderr, "删除扫描检查点时出错: %v\n", err)
+	}
+	hosts = append(hosts, pending...)
+	sortHosts(hosts)
+	return hosts, skipped, nil
+}
+
+// sortHosts 按地址顺序排列扫描结果
+func sortHosts(hosts []discoveredHost) {
+	sort.Slice(hosts, func(i, j int) bool {
+		a, _ := netip.ParseAddr(hosts[i].IP)
+		b, _ := netip.ParseAddr(hosts[j].IP)
+		return a.Less(b)
+	})
 }
 
-func ipListFromCIDR(cidr string) ([]string, error) {
-	ip, ipnet, err := net.ParseCIDR(cidr)
+// probeDialer 经由 SOCKS 代理建立探测连接，每个连接都受 --rate 限速
+type probeDialer struct {
+	dialer  proxy.ContextDialer
+	limiter *scan.Limiter
+}
+
+// dial 等待限速配额后再连接 target；等待的时间不计入 --timeout
+func (d *probeDialer) dial(ctx context.Context, target string) (net.Conn, error) {
+	if err := d.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, discoverTimeout)
+	defer cancel()
+	return d.dialer.DialContext(dialCtx, "tcp", target)
+}
+
+// probeHost 连接目标端口并读取 SSH 协议标识，开启 --fingerprint 时再取得主机公钥指纹
+// 端口未开放时返回连接错误，开放但不是 SSH 服务时返回 scan.ErrNotSSH
+func probeHost(ctx context.Context, d *probeDialer, target string) (*discoveredHost, error) {
+	dial := func() (net.Conn, error) { return d.dial(ctx, target) }
+
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	banner, err := scan.ReadBanner(conn, 3*time.Second)
+	conn.Close()
 	if err != nil {
 		return nil, err
 	}
+	host := &discoveredHost{Banner: banner}
 
-	var ips []string
-	for ip := ip.Mask(ipnet.Mask); ipnet.Contains(ip); func(ip net.IP) {
-		for j := len(ip) - 1; j >= 0; j-- {
-			ip[j]++
-			if ip[j] > 0 {
-				break
+	// 读取标识后连接已无法用于密钥交换，因此重新建立一个连接
+	if discoverFingerprint {
+		if conn, err := dial(); err == nil {
+			if key, err := scan.HostKey(conn, target, 5*time.Second); err == nil {
+				host.Fingerprint = ssh.FingerprintSHA256(key)
 			}
 		}
-	}(ip) {
-		ips = append(ips, ip.String())
 	}
-	// Remove network and broadcast addresses
-	if len(ips) > 2 {
-		return ips[1 : len(ips)-1], nil
+	return host, nil
+}
+
+// probeServices 识别 --ports 指定的各端口上运行的服务，跳过 SSH 端口和未开放的端口
+func probeServices(ctx context.Context, d *probeDialer, ip netip.Addr) []scan.Service {
+	var services []scan.Service
+	for _, port := range discoverPorts {
+		if strconv.Itoa(port) == discoverPort {
+			continue
+		}
+		target := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+		dial := func() (net.Conn, error) { return d.dial(ctx, target) }
+		if svc, err := scan.Identify(dial, port, 2*time.Second); err == nil {
+			services = append(services, *svc)
+		}
+	}
+	return services
+}
+
+// serviceForwards 为识别出的服务生成 forwards 记录，已存在的端口不会重复添加
+func serviceForwards(services []scan.Service, existing []config.Forward) []config.Forward {
+	taken := make(map[string]bool)
+	ports := make(map[int]bool)
+	for _, fwd := range existing {
+		taken[fwd.Name] = true
+		ports[fwd.RemotePort] = true
+	}
+	var forwards []config.Forward
+	for _, svc := range services {
+		if svc.Name == "ssh" || ports[svc.Port] {
+			continue
+		}
+		name := svc.Name
+		if name == "unknown" || taken[name] {
+			name = fmt.Sprintf("%s-%d", svc.Name, svc.Port)
+		}
+		taken[name] = true
+		forwards = append(forwards, config.Forward{Name: name, RemotePort: svc.Port, Service: svc.Name})
+	}
+	return forwards
+}
+
+// canonicalIP 将地址转换为规范形式，便于比较不同写法的 IPv6 地址
+func canonicalIP(ip string) string {
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		return addr.String()
 	}
-	return ips, nil
+	return ip
 }
 
 func runDiscover(cmd *cobra.Command, args []string) {
+	// Ctrl-C 只取消扫描，由 discover 负责关闭代理进程组后再退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := discover(ctx, cmd); err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "\n--> 扫描已取消。")
+			os.Exit(130)
+		}
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		os.Exit(1)
+	}
+}
+
+func discover(ctx context.Context, cmd *cobra.Command) error {
 	clusterName, _ := cmd.Flags().GetString("cluster")
 	if clusterName == "" {
-		fmt.Fprintln(os.Stderr, "错误: discover 命令需要 --cluster 标志。")
-		os.Exit(1)
+		return errors.New("discover 命令需要 --cluster 标志。")
 	}
 
 	// 1. 查找集群和跳板机信息
 	cluster, err := cfg.FindCluster(clusterName)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "错误:", err)
-		os.Exit(1)
+		return err
 	}
-	bastion := &cluster.Bastion
 
-	// 2. 启动后台 SSH SOCKS 代理
-	fmt.Println("--> 正在通过跳板机启动 SSH SOCKS 代理...")
-	proxyPort := "1080" // Standard SOCKS port
-	proxyAddr := "127.0.0.1:" + proxyPort
+	// 2. 解析 IP 范围并准备扫描
+	targets, err := scan.NewTargets(discoverRange, discoverExclude, discoverTargetsFiles)
+	if err != nil {
+		return fmt.Errorf("解析 IP 范围时出错: %w", err)
+	}
+
+	tmplText := cluster.AliasTemplate
+	if discoverAliasTmpl != "" {
+		tmplText = discoverAliasTmpl
+	}
+	aliasTmpl, err := parseAliasTemplate(tmplText)
+	if err != nil {
+		return err
+	}
 
-	sshArgs := []string{"-N", "-D", proxyAddr}
-	if bastion.IdentityFile != "" {
-		sshArgs = append(sshArgs, "-i", bastion.IdentityFile)
+	if len(discoverPorts) > 0 && discoverStrategy != "socks" {
+		return errors.New("--ports 目前仅支持 socks 扫描策略")
+	}
+	if discoverResume && discoverStrategy != "socks" {
+		return errors.New("--resume 目前仅支持 socks 扫描策略")
 	}
-	sshArgs = append(sshArgs, fmt.Sprintf("%s@%s", bastion.User, bastion.Host))
 
-	proxyCmd := exec.Command("ssh", sshArgs...)
-	proxyCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true} // Crucial for killing the process group
+	// 3. 扫描：在本地经由 SOCKS 代理探测，或直接在跳板机上运行扫描
+	var (
+		found   []discoveredHost
+		skipped int
+	)
+	switch discoverStrategy {
+	case "socks":
+		found, skipped, err = scanViaSocks(ctx, cluster, targets)
+	case "remote":
+		found, skipped, err = scanRemote(ctx, cluster, targets)
+	default:
+		return fmt.Errorf("未知的扫描策略 '%s'，可选值为 socks 或 remote", discoverStrategy)
+	}
+	if err != nil {
+		return err
+	}
 
-	if err := proxyCmd.Start(); err != nil {
-		fmt.Fprintf(os.Stderr, "启动 SSH 代理时出错: %v\n", err)
-		os.Exit(1)
+	// 4. 处理扫描结果
+	if skipped > 0 {
+		fmt.Printf("--> 已忽略 %d 个端口开放但未返回 SSH 标识的主机。\n", skipped)
 	}
-	fmt.Printf("--> SSH SOCKS 代理已在端口 %s 上成功启动 (PID: %d)\n", proxyPort, proxyCmd.Process.Pid)
+	newHosts, seen, missing := compareHosts(cluster, targets, found)
+	forwards := nodeForwards(cluster, found)
+	printServiceOnlyHosts(cluster, found)
+	reconcile := discoverMarkStale || discoverPrune
+	interactive := !discoverYes && !discoverDryRun
 
-	// 使用 defer 确保扫描结束后代理进程被终止
-	defer func() {
-		fmt.Println("\n--> 正在关闭 SSH SOCKS 代理...")
-		if err := syscall.Kill(-proxyCmd.Process.Pid, syscall.SIGKILL); err != nil {
-			fmt.Fprintf(os.Stderr, "关闭代理进程组时出错: %v\n", err)
-		} else {
-			fmt.Println("--> 代理已关闭。")
+	var added []config.Node
+	if len(newHosts) == 0 {
+		fmt.Println("\n--> 未发现新主机。")
+	} else {
+		fmt.Printf("\n✅ 扫描完成。发现 %d 个新的潜在主机:\n", len(newHosts))
+		for _, host := range newHosts {
+			line := fmt.Sprintf("  - %-15s %s", host.IP, host.Banner)
+			if host.Fingerprint != "" {
+				line += "  " + host.Fingerprint
+			}
+			fmt.Println(line)
+			for _, svc := range host.Services {
+				fmt.Printf("      %s\n", svc)
+			}
 		}
-	}()
-
-	time.Sleep(2 * time.Second)
+		// 5. 添加新节点：--yes 和 --dry-run 时不进行任何交互
+		var ok bool
+		if added, ok = planNewNodes(cluster, newHosts, aliasTmpl, interactive); !ok {
+			if !reconcile {
+				fmt.Println("操作已中止。")
+				return nil
+			}
+			fmt.Println("已跳过添加新主机。")
+		}
+	}
 
-	// 3. 解析 IP 范围并准备扫描
-	ipsToScan, err := ipListFromCIDR(discoverRange)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "解析 IP 范围时出错: %v\n", err)
-		os.Exit(1)
+	printNodeDiff(cluster, added, missing, forwards)
+	if discoverDryRun {
+		fmt.Println("\n--> 试运行模式，配置未修改。")
+		return nil
+	}
+	if len(added) == 0 && len(forwards) == 0 && !reconcile {
+		return nil
 	}
 
-	// 4. 设置 SOCKS5 拨号器
-	dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, proxy.Direct)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "创建 SOCKS5 拨号器时出错: %v\n", err)
-		os.Exit(1)
+	// 6. 对账：刷新在线节点的时间戳，标记或删除失联节点
+	var pruned []config.Node
+	if discoverPrune {
+		pruned = staleNodes(missing)
 	}
-	contextDialer, ok := dialer.(proxy.ContextDialer)
-	if !ok {
-		fmt.Fprintln(os.Stderr, "错误: 拨号器不支持 context。")
-		os.Exit(1)
+	if len(pruned) > 0 && interactive {
+		prompt := promptui.Prompt{
+			Label:     fmt.Sprintf("确认从配置中删除这 %d 个连续未响应的节点?", len(pruned)),
+			IsConfirm: true,
+		}
+		if _, err := prompt.Run(); err != nil {
+			fmt.Println("已跳过删除。")
+			pruned = nil
+		}
+	}
+	if reconcile {
+		now := time.Now().UTC().Truncate(time.Second)
+		for i := range added {
+			added[i].LastSeen = &now
+		}
+		reconcileNodes(cluster, seen, missing, pruned, now)
 	}
 
-	// 5. 并发扫描
-	var wg sync.WaitGroup
-	ipsChan := make(chan string, discoverWorkers)
-	openHosts := make(chan string, len(ipsToScan))
+	for i := range cluster.Nodes {
+		node := &cluster.Nodes[i]
+		node.Forwards = append(node.Forwards, forwards[node.Alias]...)
+	}
+	cluster.Nodes = append(cluster.Nodes, added...)
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("保存配置时出错: %w", err)
+	}
+	if len(pruned) > 0 {
+		forgetNodeKeys(cluster, pruned)
+	}
+	fmt.Println("\n✅ 配置已成功保存！")
+	return nil
+}
 
-	fmt.Printf("--> 正在扫描 %s 中的 %d 个主机，查找开放的端口 %s...\n", discoverRange, len(ipsToScan), discoverPort)
+// planNewNodes 为新主机确定用户名、别名和标签，返回将要添加的节点
+// 交互模式下用户拒绝添加时返回 false
+func planNewNodes(cluster *config.Cluster, newHosts []discoveredHost, aliasTmpl *template.Template, interactive bool) ([]config.Node, bool) {
+	if interactive {
+		prompt := promptui.Prompt{
+			Label:     "您想将这些主机添加到配置中吗?",
+			IsConfirm: true,
+		}
+		if _, err := prompt.Run(); err != nil {
+			return nil, false
+		}
+	}
 
-	for i := 0; i < discoverWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for ip := range ipsChan {
-				target := fmt.Sprintf("%s:%s", ip, discoverPort)
-				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	// 优化用户交互：一次性获取通用配置
+	userForAll := discoverDefaultUser
+	if userForAll == "" && interactive { // 如果用户没有通过 -u 标志提供默认用户
+		userPrompt := promptui.Prompt{
+			Label:   "为所有新主机输入一个通用的用户名 (可稍后逐个修改)",
+			Default: "root",
+		}
+		var err error
+		if userForAll, err = userPrompt.Run(); err != nil {
+			return nil, false
+		}
+	}
+	if userForAll == "" {
+		userForAll = "root"
+	}
 
-				conn, err := contextDialer.DialContext(ctx, "tcp", target)
-				cancel()
+	// 试运行不登录主机，也不固定它们的主机密钥
+	if discoverFacts && discoverDryRun {
+		fmt.Printf("\n--> 试运行模式，跳过信息收集；实际运行时将以 %s 登录以下 %d 台主机收集主机信息:\n", userForAll, len(newHosts))
+		for _, host := range newHosts {
+			fmt.Printf("  - %s\n", host.IP)
+		}
+	} else if discoverFacts {
+		collectFacts(cluster, newHosts, userForAll)
+	}
 
-				if err == nil {
-					conn.Close()
-					openHosts <- ip
-				}
+	taken := make(map[string]bool)
+	var added []config.Node
+	for _, host := range newHosts {
+		alias := proposeAlias(aliasTmpl, cluster, host, taken)
+		if interactive {
+			fmt.Printf("\n--- 正在添加主机 %s ---\n", host.IP)
+			aliasPrompt := promptui.Prompt{
+				Label:    fmt.Sprintf("为此主机 '%s' 输入别名", host.IP),
+				Default:  alias,
+				Validate: func(s string) error { return validateAlias(s, taken) },
 			}
-		}()
+			var err error
+			if alias, err = aliasPrompt.Run(); err != nil {
+				// Ctrl-C 等中断输入时放弃添加所有新主机，而不是添加一个没有别名的节点
+				return nil, false
+			}
+		}
+		taken[alias] = true
+		added = append(added, config.Node{
+			Alias:    alias,
+			IP:       host.IP,
+			User:     userForAll,
+			Labels:   nodeLabels(host),
+			Forwards: serviceForwards(host.Services, nil),
+		})
 	}
+	return added, true
+}
 
-	for _, ip := range ipsToScan {
-		ipsChan <- ip
+// staleNodes 返回失联节点中已经在之前的对账中被标记为 stale 的节点
+// --prune 只删除这些连续两次以上未响应的节点，避免一次网络抖动就删掉整批节点
+func staleNodes(missing []config.Node) []config.Node {
+	var nodes []config.Node
+	for _, node := range missing {
+		if node.Stale {
+			nodes = append(nodes, node)
+		}
 	}
-	close(ipsChan)
-	wg.Wait()
-	close(openHosts)
+	return nodes
+}
 
-	// 6. 处理扫描结果
-	var newHosts []string
-	existingIPs := make(map[string]bool)
-	for _, node := range cluster.Nodes {
-		existingIPs[node.IP] = true
+// reconcileNodes 更新在线节点的最后在线时间并清除失联标记，
+// 删除 pruned 中的节点，其余失联节点标记为 stale
+func reconcileNodes(cluster *config.Cluster, seen, missing, pruned []config.Node, now time.Time) {
+	aliases := func(nodes []config.Node) map[string]bool {
+		m := make(map[string]bool)
+		for _, node := range nodes {
+			m[node.Alias] = true
+		}
+		return m
 	}
+	seenAliases, missingAliases, prunedAliases := aliases(seen), aliases(missing), aliases(pruned)
 
-	for host := range openHosts {
-		if !existingIPs[host] {
-			newHosts = append(newHosts, host)
+	nodes := cluster.Nodes[:0]
+	for _, node := range cluster.Nodes {
+		switch {
+		case seenAliases[node.Alias]:
+			node.LastSeen = &now
+			node.Stale = false
+		case prunedAliases[node.Alias]:
+			continue
+		case missingAliases[node.Alias]:
+			node.Stale = true
 		}
+		nodes = append(nodes, node)
 	}
+	cluster.Nodes = nodes
+}
 
-	if len(newHosts) == 0 {
-		fmt.Println("\n--> 未发现新主机。")
+// forgetNodeKeys 删除已移除节点的固定主机密钥，避免地址被新主机复用时出现密钥冲突
+func forgetNodeKeys(cluster *config.Cluster, nodes []config.Node) {
+	path, err := hostkeys.NodePath(cluster.Name)
+	if err != nil {
 		return
 	}
-
-	fmt.Printf("\n✅ 扫描完成。发现 %d 个新的潜在主机:\n", len(newHosts))
-	for _, host := range newHosts {
-		fmt.Println("  - " + host)
+	known, err := hostkeys.Load(path)
+	if err != nil {
+		return
 	}
+	removed := 0
+	for _, node := range nodes {
+		removed += known.Forget(node.IP)
+	}
+	if removed > 0 {
+		if err := known.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "删除已移除节点的主机密钥时出错: %v\n", err)
+		}
+	}
+}
 
-	// 7. 交互式添加新节点
-	prompt := promptui.Prompt{
-		Label:     "您想将这些主机添加到配置中吗?",
-		IsConfirm: true,
+// compareHosts 将扫描结果与集群现有节点比较，返回新发现的主机、本次响应的已配置节点，
+// 以及在扫描范围内但本次没有响应的已配置节点
+func compareHosts(cluster *config.Cluster, targets *scan.Targets, found []discoveredHost) (newHosts []discoveredHost, seen, missing []config.Node) {
+	existingIPs := make(map[string]bool)
+	for _, node := range cluster.Nodes {
+		existingIPs[canonicalIP(node.IP)] = true
 	}
-	if _, err := prompt.Run(); err != nil {
-		fmt.Println("操作已中止。")
-		return
+	foundIPs := make(map[string]bool)
+	for _, host := range found {
+		if host.Banner == nil {
+			continue
+		}
+		foundIPs[host.IP] = true
+		if !existingIPs[host.IP] {
+			newHosts = append(newHosts, host)
+		}
 	}
 
-	// --- 核心修改点 ---
-	// 优化用户交互：一次性获取通用配置
-	userForAll := discoverDefaultUser
-	if userForAll == "" { // 如果用户没有通过 -u 标志提供默认用户
-		userPrompt := promptui.Prompt{
-			Label:   "为所有新主机输入一个通用的用户名 (可稍后逐个修改)",
-			Default: "root",
+	for _, node := range cluster.Nodes {
+		addr, err := netip.ParseAddr(node.IP)
+		if err != nil || !targets.Contains(addr) {
+			continue
+		}
+		if foundIPs[addr.String()] {
+			seen = append(seen, node)
+		} else {
+			missing = append(missing, node)
+		}
+	}
+	return newHosts, seen, missing
+}
+
+// nodeForwards 返回已配置节点上新发现的服务，按节点别名索引
+func nodeForwards(cluster *config.Cluster, found []discoveredHost) map[string][]config.Forward {
+	forwards := make(map[string][]config.Forward)
+	for _, host := range found {
+		for _, node := range cluster.Nodes {
+			if canonicalIP(node.IP) != host.IP {
+				continue
+			}
+			if fwds := serviceForwards(host.Services, node.Forwards); len(fwds) > 0 {
+				forwards[node.Alias] = fwds
+			}
 		}
-		userForAll, _ = userPrompt.Run()
 	}
+	return forwards
+}
 
-	for _, host := range newHosts {
-		fmt.Printf("\n--- 正在添加主机 %s ---\n", host)
-		aliasPrompt := promptui.Prompt{
-			Label:   fmt.Sprintf("为此主机 '%s' 输入别名", host),
-			Default: fmt.Sprintf("node-%s", host),
+// printServiceOnlyHosts 报告没有 SSH 服务、也不是已配置节点的主机上发现的服务
+func printServiceOnlyHosts(cluster *config.Cluster, found []discoveredHost) {
+	existingIPs := make(map[string]bool)
+	for _, node := range cluster.Nodes {
+		existingIPs[canonicalIP(node.IP)] = true
+	}
+	printed := false
+	for _, host := range found {
+		if host.Banner != nil || existingIPs[host.IP] {
+			continue
+		}
+		if !printed {
+			fmt.Println("\n--> 以下主机没有可用的 SSH 服务，其上的服务不会被保存:")
+			printed = true
+		}
+		for _, svc := range host.Services {
+			fmt.Printf("  - %-15s %s\n", host.IP, svc)
 		}
-		alias, _ := aliasPrompt.Run()
+	}
+}
 
-		// 直接使用之前获取的通用用户名
-		cluster.AddNode(alias, host, userForAll)
-		fmt.Printf("已添加节点: %s (%s)，用户名为 %s\n", alias, host, userForAll)
+// nodeLabels 合并收集到的主机信息和 --labels 指定的标签，后者优先
+func nodeLabels(host discoveredHost) map[string]string {
+	if len(host.Facts) == 0 && len(discoverLabels) == 0 {
+		return nil
+	}
+	labels := make(map[string]string)
+	for k, v := range host.Facts {
+		labels[k] = v
+	}
+	for k, v := range discoverLabels {
+		labels[k] = v
 	}
+	return labels
+}
 
-	if err := cfg.Save(); err != nil {
-		fmt.Fprintf(os.Stderr, "\n保存配置时出错: %v\n", err)
-	} else {
-		fmt.Println("\n✅ 配置已成功保存！")
+// printNodeDiff 打印本次发现对集群配置的影响
+// 未响应的节点在 --prune 时显示为删除 (-)，--mark-stale 时显示为标记失联 (~)，否则仅作提示 (!)
+func printNodeDiff(cluster *config.Cluster, added, missing []config.Node, forwards map[string][]config.Forward) {
+	if len(added) == 0 && len(missing) == 0 && len(forwards) == 0 {
+		return
+	}
+	fmt.Printf("\n--> 集群 '%s' 的节点变更:\n", cluster.Name)
+	for _, node := range added {
+		fmt.Printf("  + %-20s %s%s\n", node.Alias, nodeAddr(&node), describeForwards(node.Forwards))
+	}
+	for _, node := range cluster.Nodes {
+		if fwds, ok := forwards[node.Alias]; ok {
+			fmt.Printf("  * %-20s %s 新增服务%s\n", node.Alias, nodeAddr(&node), describeForwards(fwds))
+		}
+	}
+	for _, node := range missing {
+		lastSeen := "从未记录"
+		if node.LastSeen != nil {
+			lastSeen = node.LastSeen.Local().Format("2006-01-02 15:04")
+		}
+		switch {
+		case discoverPrune && node.Stale:
+			fmt.Printf("  - %-20s %s (连续未响应，最后在线: %s)\n", node.Alias, nodeAddr(&node), lastSeen)
+		case discoverPrune, discoverMarkStale:
+			fmt.Printf("  ~ %-20s %s (未响应，将标记为失联，最后在线: %s)\n", node.Alias, nodeAddr(&node), lastSeen)
+		default:
+			fmt.Printf("  ! %-20s %s (在扫描范围内但未响应，最后在线: %s)\n", node.Alias, nodeAddr(&node), lastSeen)
+		}
+	}
+}
+
+// describeForwards 返回 forwards 记录的简要描述，如 " [postgres:5432, kubernetes:6443]"
+func describeForwards(forwards []config.Forward) string {
+	if len(forwards) == 0 {
+		return ""
+	}
+	parts := make([]string, len(forwards))
+	for i, fwd := range forwards {
+		parts[i] = fmt.Sprintf("%s:%d", fwd.Name, fwd.RemotePort)
 	}
+	return " [" + strings.Join(parts, ", ") + "]"
 }
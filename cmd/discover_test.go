@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gitlayzer/kgate/internal/config"
+)
+
+func TestReconcileNodes(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		nodes   []config.Node
+		seen    []string
+		missing []string
+		prune   bool
+		want    map[string]bool // 保留的节点及其 stale 状态
+	}{
+		{
+			name:    "mark stale",
+			nodes:   []config.Node{{Alias: "a"}, {Alias: "b"}},
+			seen:    []string{"a"},
+			missing: []string{"b"},
+			want:    map[string]bool{"a": false, "b": true},
+		},
+		{
+			name:  "seen clears stale",
+			nodes: []config.Node{{Alias: "a", Stale: true}},
+			seen:  []string{"a"},
+			want:  map[string]bool{"a": false},
+		},
+		{
+			name:    "prune keeps first-time missing nodes",
+			nodes:   []config.Node{{Alias: "a"}, {Alias: "b"}},
+			missing: []string{"a", "b"},
+			prune:   true,
+			want:    map[string]bool{"a": true, "b": true},
+		},
+		{
+			name:    "prune removes nodes already stale",
+			nodes:   []config.Node{{Alias: "a", Stale: true}, {Alias: "b"}, {Alias: "c"}},
+			seen:    []string{"c"},
+			missing: []string{"a", "b"},
+			prune:   true,
+			want:    map[string]bool{"b": true, "c": false},
+		},
+		{
+			name:  "nodes outside the range untouched",
+			nodes: []config.Node{{Alias: "a", Stale: true}, {Alias: "b"}},
+			prune: true,
+			want:  map[string]bool{"a": true, "b": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &config.Cluster{Nodes: append([]config.Node(nil), tt.nodes...)}
+			pick := func(aliases []string) []config.Node {
+				var nodes []config.Node
+				for _, node := range tt.nodes {
+					for _, alias := range aliases {
+						if node.Alias == alias {
+							nodes = append(nodes, node)
+						}
+					}
+				}
+				return nodes
+			}
+			missing := pick(tt.missing)
+			var pruned []config.Node
+			if tt.prune {
+				pruned = staleNodes(missing)
+			}
+			reconcileNodes(cluster, pick(tt.seen), missing, pruned, now)
+
+			got := map[string]bool{}
+			for _, node := range cluster.Nodes {
+				got[node.Alias] = node.Stale
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nodes = %v, want %v", got, tt.want)
+			}
+			for _, node := range cluster.Nodes {
+				for _, alias := range tt.seen {
+					if node.Alias == alias && (node.LastSeen == nil || !node.LastSeen.Equal(now)) {
+						t.Errorf("%s: lastSeen = %v, want %v", alias, node.LastSeen, now)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	defer func(c *config.Config) { cfg = c }(cfg)
+	cfg = &config.Config{Clusters: []config.Cluster{{Name: "prod", Nodes: []config.Node{{Alias: "web1"}}}}}
+	taken := map[string]bool{"db1": true}
+	tests := []struct {
+		alias string
+		ok    bool
+	}{
+		{"web2", true},
+		{"prod-10", true},
+		{"", false},
+		{"web 2", false},
+		{"web:2", false},
+		{"web1", false}, // 配置中已有的别名
+		{"db1", false},  // 本次已经分配给其它新主机的别名
+	}
+	for _, tt := range tests {
+		if err := validateAlias(tt.alias, taken); (err == nil) != tt.ok {
+			t.Errorf("validateAlias(%q) = %v, want ok %v", tt.alias, err, tt.ok)
+		}
+	}
+}
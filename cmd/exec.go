@@ -3,12 +3,13 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+var execSudo bool
+
 var execCmd = &cobra.Command{
 	Use:   "exec [node-alias] [command...]",
 	Short: "Execute a non-interactive command on a remote node",
@@ -16,6 +17,8 @@ var execCmd = &cobra.Command{
 This command is non-interactive. It's useful for running scripts or getting quick outputs.`,
 	Args: cobra.MinimumNArgs(2),
 	Run:  runExec,
+
+	ValidArgsFunction: completeNodeAlias,
 }
 
 func runExec(cmd *cobra.Command, args []string) {
@@ -29,37 +32,62 @@ func runExec(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	bastion := cluster.Bastion
-	bastionAddr := fmt.Sprintf("%s@%s", bastion.User, bastion.Host)
-	nodeAddr := fmt.Sprintf("%s@%s", node.User, node.IP)
-
 	fmt.Printf("--> Executing on %s via bastion %s: [%s]\n", node.Alias, cluster.Name, commandToRun)
+	if err := pinNodeKey(cluster, node); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 
 	// 构建将在跳板机上执行的远程命令
 	// 注意：这里没有 -t 参数，因为我们不需要交互式终端
 	// 我们将用户的命令用双引号包裹，以确保它被作为一个整体在目标节点上执行
-	remoteCommand := fmt.Sprintf("ssh %s \"%s\"", nodeAddr, commandToRun)
-
-	// 构建最终的 ssh 命令参数
-	var sshArgs []string
+	remoteCommand := fmt.Sprintf("\"%s\"", commandToRun)
 
-	if bastion.IdentityFile != "" {
-		sshArgs = append(sshArgs, "-i", bastion.IdentityFile)
+	var sudoPassword string
+	if execSudo {
+		password, ok, err := clusterSecret(cluster, secretSudoPassword)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: no '%s' secret for cluster '%s', use 'kgate secret set' first\n", secretSudoPassword, cluster.Name)
+			os.Exit(1)
+		}
+		sudoPassword = password
+		// sudo 从标准输入读取密码，这样密码不会出现在任何一方的命令行参数中
+		sudoCommand := "sudo -S -p '' sh -c " + shellQuote(commandToRun)
+		remoteCommand = shellQuote(sudoCommand)
+	}
+	remoteCommand, err = nodeCommand(cluster, node, nil, remoteCommand)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
 	}
-
-	sshArgs = append(sshArgs, bastionAddr, remoteCommand)
 
 	// 创建 exec.Command
-	sshCmd := exec.Command("ssh", sshArgs...)
+	sshCmd, err := sshCommand(cluster, nil, remoteCommand)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 
 	// 对于 exec，我们只需要获取其输出，所以连接 stdout 和 stderr
 	sshCmd.Stdout = os.Stdout
 	sshCmd.Stderr = os.Stderr
-	// 注意：我们不连接 stdin，因为这是非交互式的
+	// 注意：我们不连接 stdin，因为这是非交互式的；使用 --sudo 时只写入 sudo 密码
+	if execSudo {
+		sshCmd.Stdin = strings.NewReader(sudoPassword + "\n")
+	}
 
 	// 执行命令
 	if err := sshCmd.Run(); err != nil {
 		// SSH 客户端会自己打印详细的错误信息
+		checkNodeHostKey(cluster, node, err)
 		os.Exit(1)
 	}
 }
+
+func init() {
+	execCmd.Flags().BoolVar(&execSudo, "sudo", false, "Run the command with sudo, using the cluster's encrypted 'sudo-password' secret")
+}
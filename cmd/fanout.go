@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/gitlayzer/kgate/internal/transfer"
+)
+
+// openSFTPs 依次打开到每个目标节点的 SFTP 会话，失败的目标在 errs 中记录原因
+// 会话按顺序建立，首次连接时的主机密钥固定不会并发执行
+func openSFTPs(targets []remoteTarget) ([]*transfer.Client, []error) {
+	clients := make([]*transfer.Client, len(targets))
+	errs := make([]error, len(targets))
+	for i, t := range targets {
+		clients[i], errs[i] = openSFTP(t.cluster, t.node)
+	}
+	return clients, errs
+}
+
+func closeSFTPs(clients []*transfer.Client) {
+	for _, c := range clients {
+		if c != nil {
+			c.Close()
+		}
+	}
+}
+
+// fanOutUpload 将本地文件或目录并行上传到多个节点的 remoteDest，本地数据只读取一次
+// 每个节点上的目标路径按 resolveDestination 各自确定
+func fanOutUpload(targets []remoteTarget, localPath, remoteDest string) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	total, err := transfer.LocalSize(localPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("--> Uploading %s to %d node(s)...\n", localPath, len(targets))
+	clients, errs := openSFTPs(targets)
+	defer closeSFTPs(clients)
+
+	remoteDest = sftpPath(remoteDest)
+	verifiers := make([]*transferVerifier, len(targets))
+	var dests []transfer.Destination
+	var destIndex []int
+	for i, c := range clients {
+		if errs[i] != nil {
+			continue
+		}
+		final, err := resolveDestination(sftpStat(c), path.Join, path.Dir, remoteDest, filepath.Base(localPath), info.IsDir(), false, scpMode())
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		verifiers[i] = newTransferVerifier(targets[i], true)
+		dests = append(dests, transfer.Destination{Client: c, Path: final, OnFile: verifiers[i].options(transfer.Options{}).OnFile})
+		destIndex = append(destIndex, i)
+	}
+
+	if len(dests) > 0 {
+		progress := startTransferProgress(total)
+		for j, err := range transfer.UploadMany(dests, localPath, transfer.Options{Progress: progress.Add, Limiter: transferLimiter}) {
+			errs[destIndex[j]] = err
+		}
+		progress.Stop()
+
+		for i, c := range clients {
+			if errs[i] == nil {
+				errs[i] = verifiers[i].verify(func(f verifiedFile, opts transfer.Options) error {
+					return c.Upload(f.src, f.dst, opts)
+				})
+			}
+		}
+	}
+	printTransferReport(targets, errs)
+}
+
+// fanInDownload 并行地从多个节点下载同一个远端路径（可含通配符），每个节点的文件保存在 localDir/<alias>/ 下
+func fanInDownload(targets []remoteTarget, remotePattern, localDir string) {
+	fmt.Printf("--> Downloading %s from %d node(s) into %s...\n", remotePattern, len(targets), filepath.Join(localDir, "<alias>"))
+	clients, errs := openSFTPs(targets)
+	defer closeSFTPs(clients)
+
+	remotePattern = sftpPath(remotePattern)
+	sources := make([][]remoteSource, len(targets))
+	parallel(targets, errs, func(i int) error {
+		dir := filepath.Join(localDir, targets[i].node.Alias)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		var err error
+		sources[i], err = planRemoteSources(clients[i], remotePattern, localStat, filepath.Join, filepath.Dir, dir, scpMode())
+		return err
+	})
+	var total int64
+	for _, nodeSources := range sources {
+		for _, src := range nodeSources {
+			total += src.size
+		}
+	}
+
+	verifiers := make([]*transferVerifier, len(targets))
+	progress := startTransferProgress(total)
+	parallel(targets, errs, func(i int) error {
+		verifiers[i] = newTransferVerifier(targets[i], false)
+		alias := targets[i].node.Alias
+		onSkip := func(remote string, err error) { warnSkipped(alias+":"+remote, err) }
+		for _, src := range sources[i] {
+			if err := clients[i].Download(src.path, src.final, verifiers[i].options(transfer.Options{Resume: scpResume, Progress: progress.Add, Limiter: transferLimiter, OnSkip: onSkip})); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	progress.Stop()
+
+	for i, c := range clients {
+		if errs[i] == nil {
+			errs[i] = verifiers[i].verify(func(f verifiedFile, opts transfer.Options) error {
+				return c.Download(f.src, f.dst, opts)
+			})
+		}
+	}
+	printTransferReport(targets, errs)
+}
+
+// parallel 在每个尚未失败的目标上并行执行 fn，并记录失败
+func parallel(targets []remoteTarget, errs []error, fn func(i int) error) {
+	var wg sync.WaitGroup
+	for i := range targets {
+		if errs[i] != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// printTransferReport 打印每个节点的传输结果，有失败时以非零状态退出
+func printTransferReport(targets []remoteTarget, errs []error) {
+	failed := 0
+	for i, t := range targets {
+		if errs[i] != nil {
+			failed++
+			fmt.Printf("  ❌ %s: %v\n", t, errs[i])
+			continue
+		}
+		fmt.Printf("  ✅ %s\n", t)
+	}
+	fmt.Printf("--> %d succeeded, %d failed\n", len(targets)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,399 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/hostkeys"
+	"github.com/gitlayzer/kgate/internal/sshkey"
+	"github.com/spf13/cobra"
+)
+
+var hostkeysCmd = &cobra.Command{
+	Use:   "hostkeys",
+	Short: "Manage pinned host keys of bastions and nodes",
+	Long: `kgate keeps its own known_hosts for bastions and nodes (trust on first use).
+Node host keys are verified by kgate instead of the bastion's known_hosts, and a
+connection is refused when a pinned key changes.`,
+}
+
+var hostkeysScanCmd = &cobra.Command{
+	Use:   "scan [node-alias...]",
+	Short: "Scan and pin host keys of a cluster's bastion and nodes",
+	Run:   runHostkeysScan,
+}
+
+var hostkeysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pinned host keys",
+	Run:   runHostkeysList,
+}
+
+var hostkeysForgetCmd = &cobra.Command{
+	Use:   "forget [node-alias|host]",
+	Short: "Forget the pinned host keys of a node or bastion",
+	Args:  cobra.ExactArgs(1),
+	Run:   runHostkeysForget,
+}
+
+// pinnedNodeKeys 返回节点已固定的主机密钥，尚未固定时返回错误，不会产生任何副作用
+func pinnedNodeKeys(cluster *config.Cluster, node *config.Node) ([]*sshkey.PublicKey, error) {
+	path, err := hostkeys.NodePath(cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+	known, err := hostkeys.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := known.Lookup(node.IP)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("host key of node '%s' (%s) is not pinned yet", node.Alias, node.IP)
+	}
+	return keys, nil
+}
+
+// pinNodeKey 在真正连接节点之前调用：节点的主机密钥尚未固定时，通过跳板机扫描并固定（TOFU）
+// 构建命令（nodeCommand）本身从不写入 known_hosts，因此补全、试运行等路径不会固定密钥
+func pinNodeKey(cluster *config.Cluster, node *config.Node) error {
+	path, err := hostkeys.NodePath(cluster.Name)
+	if err != nil {
+		return err
+	}
+	known, err := hostkeys.Load(path)
+	if err != nil {
+		return err
+	}
+	if len(known.Lookup(node.IP)) > 0 {
+		return nil
+	}
+
+	scanned, err := scanNodeKeys(cluster, node.IP)
+	if err != nil {
+		return fmt.Errorf("scanning host key of node '%s': %w", node.Alias, err)
+	}
+	keys := scanned[node.IP]
+	if len(keys) == 0 {
+		return fmt.Errorf("node '%s' (%s) did not present any host key", node.Alias, node.IP)
+	}
+	for _, key := range keys {
+		known.Add(node.IP, key)
+		fmt.Fprintf(os.Stderr, "--> Pinned host key of node %s (%s): %s %s\n", node.Alias, node.IP, key.Type, key.Fingerprint())
+	}
+	return known.Save()
+}
+
+// scanNodeKeys 在跳板机上运行 ssh-keyscan 获取节点的主机密钥
+func scanNodeKeys(cluster *config.Cluster, ips ...string) (map[string][]*sshkey.PublicKey, error) {
+	remote := "ssh-keyscan -T 5 " + strings.Join(ips, " ")
+	scanCmd, err := sshCommand(cluster, nil, remote)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	scanCmd.Stdout = &stdout
+	scanCmd.Stderr = &stderr
+	runErr := scanCmd.Run()
+	keys := hostkeys.ParseScan(stdout.String())
+	if len(keys) == 0 && runErr != nil {
+		return nil, commandError(runErr, &stderr)
+	}
+	return keys, nil
+}
+
+// scanBastionKeys 在本地运行 ssh-keyscan 获取跳板机的主机密钥
+func scanBastionKeys(host string) ([]*sshkey.PublicKey, error) {
+	var stdout, stderr bytes.Buffer
+	scanCmd := exec.Command("ssh-keyscan", "-T", "5", host)
+	scanCmd.Stdout = &stdout
+	scanCmd.Stderr = &stderr
+	runErr := scanCmd.Run()
+	keys := hostkeys.ParseScan(stdout.String())[host]
+	if len(keys) == 0 && runErr != nil {
+		return nil, commandError(runErr, &stderr)
+	}
+	return keys, nil
+}
+
+// commandError 将命令的错误输出附加到错误信息中
+func commandError(err error, stderr *bytes.Buffer) error {
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%v: %s", err, msg)
+	}
+	return err
+}
+
+// checkNodeHostKey 在 ssh 以 255 退出后调用，若节点的主机密钥发生了变化则打印明确的错误
+func checkNodeHostKey(cluster *config.Cluster, node *config.Node, err error) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 255 {
+		return
+	}
+	path, pathErr := hostkeys.NodePath(cluster.Name)
+	if pathErr != nil {
+		return
+	}
+	known, loadErr := hostkeys.Load(path)
+	if loadErr != nil {
+		return
+	}
+	scanned, scanErr := scanNodeKeys(cluster, node.IP)
+	if scanErr != nil {
+		return
+	}
+	if was, now := hostkeys.Changed(known.Lookup(node.IP), scanned[node.IP]); was != nil {
+		printHostKeyChanged(node.Alias+" ("+node.IP+")", was, now)
+		fmt.Fprintf(os.Stderr, "If this change is expected, run 'kgate hostkeys forget %s' and connect again.\n", node.Alias)
+	}
+}
+
+func printHostKeyChanged(target string, was, now *sshkey.PublicKey) {
+	fmt.Fprintf(os.Stderr, "❌ Host key of %s has CHANGED! Someone could be intercepting the connection.\n", target)
+	fmt.Fprintf(os.Stderr, "   pinned:    %s %s\n", was.Type, was.Fingerprint())
+	fmt.Fprintf(os.Stderr, "   presented: %s %s\n", now.Type, now.Fingerprint())
+}
+
+func runHostkeysScan(cmd *cobra.Command, args []string) {
+	clusterName, _ := cmd.Flags().GetString("cluster")
+	cluster, err := cfg.FindCluster(clusterName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	changed := false
+
+	// 跳板机
+	bastionPath, err := hostkeys.BastionPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	bastionKnown, err := hostkeys.Load(bastionPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("--> Scanning bastion %s...\n", cluster.Bastion.Host)
+	keys, err := scanBastionKeys(cluster.Bastion.Host)
+	if err != nil {
+		fmt.Printf("  ⚠️  bastion %s: %v\n", cluster.Bastion.Host, err)
+	} else if pinKeys(bastionKnown, "bastion "+cluster.Bastion.Host, cluster.Bastion.Host, keys) {
+		changed = true
+	}
+	if err := bastionKnown.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	// 节点
+	nodes := cluster.Nodes
+	if len(args) > 0 {
+		nodes = nil
+		for _, alias := range args {
+			node := findClusterNode(cluster, alias)
+			if node == nil {
+				fmt.Fprintf(os.Stderr, "Error: node '%s' not found in cluster '%s'\n", alias, cluster.Name)
+				os.Exit(1)
+			}
+			nodes = append(nodes, *node)
+		}
+	}
+	if len(nodes) == 0 {
+		return
+	}
+
+	nodePath, err := hostkeys.NodePath(cluster.Name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	nodeKnown, err := hostkeys.Load(nodePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	var ips []string
+	for _, node := range nodes {
+		ips = append(ips, node.IP)
+	}
+	fmt.Printf("--> Scanning %d node(s) via bastion %s...\n", len(nodes), cluster.Name)
+	scanned, err := scanNodeKeys(cluster, ips...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	for _, node := range nodes {
+		target := fmt.Sprintf("%s (%s)", node.Alias, node.IP)
+		if len(scanned[node.IP]) == 0 {
+			fmt.Printf("  ⚠️  %s: no response\n", target)
+			continue
+		}
+		if pinKeys(nodeKnown, target, node.IP, scanned[node.IP]) {
+			changed = true
+		}
+	}
+	if err := nodeKnown.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if changed {
+		os.Exit(1)
+	}
+}
+
+// pinKeys 固定扫描到的公钥并打印结果，若与已固定的公钥冲突则返回 true（不会替换）
+func pinKeys(known *hostkeys.File, target, host string, keys []*sshkey.PublicKey) bool {
+	pinned := known.Lookup(host)
+	if was, now := hostkeys.Changed(pinned, keys); was != nil {
+		printHostKeyChanged(target, was, now)
+		return true
+	}
+	if len(pinned) > 0 {
+		fmt.Printf("  ✅ %s: unchanged\n", target)
+	} else {
+		fmt.Printf("  📌 %s: pinned\n", target)
+	}
+	for _, key := range keys {
+		known.Add(host, key)
+	}
+	return false
+}
+
+func runHostkeysList(cmd *cobra.Command, args []string) {
+	clusterName, _ := cmd.Flags().GetString("cluster")
+	bastionPath, err := hostkeys.BastionPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	bastionKnown, err := hostkeys.Load(bastionPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	for i := range cfg.Clusters {
+		cluster := &cfg.Clusters[i]
+		if clusterName != "" && cluster.Name != clusterName {
+			continue
+		}
+		fmt.Printf("Cluster '%s':\n", cluster.Name)
+		printPinned("bastion "+cluster.Bastion.Host, bastionKnown.Lookup(cluster.Bastion.Host))
+
+		nodePath, err := hostkeys.NodePath(cluster.Name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		nodeKnown, err := hostkeys.Load(nodePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		for _, ip := range nodeKnown.Hosts() {
+			target := ip
+			for _, node := range cluster.Nodes {
+				if node.IP == ip {
+					target = fmt.Sprintf("%s (%s)", node.Alias, ip)
+					break
+				}
+			}
+			printPinned(target, nodeKnown.Lookup(ip))
+		}
+	}
+}
+
+func printPinned(target string, keys []*sshkey.PublicKey) {
+	if len(keys) == 0 {
+		fmt.Printf("  - %s: not pinned\n", target)
+		return
+	}
+	for _, key := range keys {
+		fmt.Printf("  - %s: %s %s\n", target, key.Type, key.Fingerprint())
+	}
+}
+
+func runHostkeysForget(cmd *cobra.Command, args []string) {
+	clusterName, _ := cmd.Flags().GetString("cluster")
+	target := args[0]
+
+	var path, host string
+	if node, cluster, err := cfg.FindNode(target); err == nil && (clusterName == "" || cluster.Name == clusterName) {
+		path, err = hostkeys.NodePath(cluster.Name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		host = node.IP
+	} else if clusterName != "" && findBastionCluster(target) == nil {
+		// 一个未配置为节点的地址，例如已经被删除的节点
+		path, err = hostkeys.NodePath(clusterName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		host = target
+	} else {
+		path, err = hostkeys.BastionPath()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		host = target
+		if cluster := findBastionCluster(target); cluster != nil {
+			host = cluster.Bastion.Host
+		}
+	}
+
+	known, err := hostkeys.Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	removed := known.Forget(host)
+	if removed == 0 {
+		fmt.Printf("No pinned host keys for '%s'.\n", target)
+		return
+	}
+	if err := known.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Forgot %d host key(s) of '%s'.\n", removed, target)
+}
+
+// findBastionCluster 按集群名或跳板机地址查找集群
+func findBastionCluster(target string) *config.Cluster {
+	for i := range cfg.Clusters {
+		if cfg.Clusters[i].Name == target || cfg.Clusters[i].Bastion.Host == target {
+			return &cfg.Clusters[i]
+		}
+	}
+	return nil
+}
+
+func findClusterNode(cluster *config.Cluster, alias string) *config.Node {
+	for i := range cluster.Nodes {
+		if cluster.Nodes[i].Alias == alias {
+			return &cluster.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func init() {
+	hostkeysScanCmd.Flags().String("cluster", "", "The name of the cluster")
+	hostkeysScanCmd.MarkFlagRequired("cluster")
+	hostkeysListCmd.Flags().String("cluster", "", "Only list host keys of this cluster")
+	hostkeysForgetCmd.Flags().String("cluster", "", "The cluster the node or address belongs to")
+
+	hostkeysCmd.AddCommand(hostkeysScanCmd)
+	hostkeysCmd.AddCommand(hostkeysListCmd)
+	hostkeysCmd.AddCommand(hostkeysForgetCmd)
+}
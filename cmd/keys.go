@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gitlayzer/kgate/internal/sshkey"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keysKeyFile     string
+	keysFingerprint string
+	keysSkipBastion bool
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage authorized_keys on a cluster's bastion and nodes",
+	Long: `Adds, removes or audits entries in ~/.ssh/authorized_keys on every node of a
+cluster (and its bastion) through the bastion hop. Operations are idempotent and
+report their result per node.`,
+}
+
+var keysPushCmd = &cobra.Command{
+	Use:   "push [node-alias...]",
+	Short: "Add a public key to authorized_keys",
+	Run:   runKeysPush,
+}
+
+var keysRevokeCmd = &cobra.Command{
+	Use:   "revoke [node-alias...]",
+	Short: "Remove a public key from authorized_keys",
+	Run:   runKeysRevoke,
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list [node-alias...]",
+	Short: "List the keys in authorized_keys",
+	Run:   runKeysList,
+}
+
+// keysTargets 返回 --cluster 指定集群中需要操作的跳板机和节点
+func keysTargets(cmd *cobra.Command, aliases []string) []remoteTarget {
+	clusterName, _ := cmd.Flags().GetString("cluster")
+	cluster, err := cfg.FindCluster(clusterName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	var targets []remoteTarget
+	if !keysSkipBastion && len(aliases) == 0 {
+		targets = append(targets, remoteTarget{cluster: cluster})
+	}
+	if len(aliases) == 0 {
+		for i := range cluster.Nodes {
+			targets = append(targets, remoteTarget{cluster: cluster, node: &cluster.Nodes[i]})
+		}
+		return targets
+	}
+	for _, alias := range aliases {
+		node := findClusterNode(cluster, alias)
+		if node == nil {
+			fmt.Fprintf(os.Stderr, "Error: node '%s' not found in cluster '%s'\n", alias, cluster.Name)
+			os.Exit(1)
+		}
+		targets = append(targets, remoteTarget{cluster: cluster, node: node})
+	}
+	return targets
+}
+
+// readPublicKey 读取 --key 指定的公钥文件
+func readPublicKey() *sshkey.PublicKey {
+	if keysKeyFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: --key is required")
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(keysKeyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	key, _, err := sshkey.ParseAuthorizedKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	return key
+}
+
+func runKeysPush(cmd *cobra.Command, args []string) {
+	key := readPublicKey()
+	targets := keysTargets(cmd, args)
+	fmt.Printf("--> Pushing key %s (%s) to %d target(s)...\n", key.Fingerprint(), key.Comment, len(targets))
+
+	// 以公钥数据判断是否已存在，因此注释或选项不同的同一把密钥不会被重复添加。
+	// 与 revoke 一样先写入临时文件再用 mv 原子地替换；原文件最后一行没有换行符时先补上，
+	// 否则新公钥会接在最后一把公钥的同一行，两把密钥都无法使用
+	script := fmt.Sprintf(`umask 077; f=~/.ssh/authorized_keys; mkdir -p ~/.ssh && touch "$f" || exit 1; `+
+		`grep -qF %s "$f"; rc=$?; `+
+		`if [ $rc -eq 0 ]; then echo present; exit 0; fi; `+
+		`if [ $rc -ne 1 ]; then echo "cannot read $f" >&2; exit 1; fi; `+
+		`t=$(mktemp "$f.kgate.XXXXXX") || exit 1; `+
+		`if cat "$f" > "$t" && { [ ! -s "$f" ] || [ -z "$(tail -c1 "$f")" ] || echo >> "$t"; } && `+
+		`printf '%%s\n' %s >> "$t" && mv -f "$t" "$f"; then echo added; `+
+		`else rm -f "$t"; echo "updating $f failed, left it unchanged" >&2; exit 1; fi`,
+		shellQuote(key.Blob), shellQuote(key.String()))
+	results := runOnTargets(targets, func(remoteTarget) string { return script })
+	printKeysReport(results, map[string]string{"added": "✅ added", "present": "= already present"})
+}
+
+func runKeysRevoke(cmd *cobra.Command, args []string) {
+	var blobs []string
+	if keysFingerprint == "" {
+		blobs = []string{readPublicKey().Blob}
+	}
+	targets := keysTargets(cmd, args)
+
+	if keysFingerprint != "" {
+		// 只知道指纹时，先读取各目标的 authorized_keys 找出对应的公钥数据
+		seen := map[string]bool{}
+		for _, res := range runOnTargets(targets, func(remoteTarget) string { return "cat ~/.ssh/authorized_keys 2>/dev/null || true" }) {
+			for _, line := range strings.Split(res.stdout, "\n") {
+				key, _, err := sshkey.ParseAuthorizedKey(line)
+				if err == nil && key.Fingerprint() == keysFingerprint && !seen[key.Blob] {
+					seen[key.Blob] = true
+					blobs = append(blobs, key.Blob)
+				}
+			}
+		}
+		if len(blobs) == 0 {
+			fmt.Printf("Key %s is not present on any target.\n", keysFingerprint)
+			return
+		}
+	}
+
+	fmt.Printf("--> Revoking key from %d target(s)...\n", len(targets))
+	var patterns []string
+	for _, blob := range blobs {
+		patterns = append(patterns, "-e "+shellQuote(blob))
+	}
+	grepArgs := strings.Join(patterns, " ")
+	// 过滤后的内容先写入同一目录下的临时文件，再用 mv 原子地替换原文件。
+	// grep 的退出码只有 0 和 1 表示成功（1 表示过滤后没有剩下任何行），
+	// 其它情况（读取失败、磁盘已满等）放弃修改，原文件保持不变
+	script := fmt.Sprintf(`f=~/.ssh/authorized_keys; [ -f "$f" ] || { echo absent; exit 0; }; `+
+		`grep -qF %s "$f"; rc=$?; `+
+		`if [ $rc -eq 1 ]; then echo absent; exit 0; fi; `+
+		`if [ $rc -ne 0 ]; then echo "cannot read $f" >&2; exit 1; fi; `+
+		`t=$(mktemp "$f.kgate.XXXXXX") || exit 1; `+
+		`grep -vF %s "$f" > "$t"; rc=$?; `+
+		`if [ $rc -le 1 ] && mv -f "$t" "$f"; then echo removed; `+
+		`else rm -f "$t"; echo "rewriting $f failed, left it unchanged" >&2; exit 1; fi`, grepArgs, grepArgs)
+	results := runOnTargets(targets, func(remoteTarget) string { return script })
+	printKeysReport(results, map[string]string{"removed": "✅ removed", "absent": "= not present"})
+}
+
+func runKeysList(cmd *cobra.Command, args []string) {
+	targets := keysTargets(cmd, args)
+	results := runOnTargets(targets, func(remoteTarget) string { return "cat ~/.ssh/authorized_keys 2>/dev/null || true" })
+	failed := false
+	for _, res := range results {
+		fmt.Printf("%s:\n", res.target)
+		if res.err != nil {
+			fmt.Printf("  ❌ %s\n", targetError(res))
+			failed = true
+			continue
+		}
+		count := 0
+		for _, line := range strings.Split(res.stdout, "\n") {
+			key, options, err := sshkey.ParseAuthorizedKey(line)
+			if err != nil {
+				continue
+			}
+			count++
+			fmt.Printf("  - %s %s %s", key.Fingerprint(), key.Type, key.Comment)
+			if options != "" {
+				fmt.Printf(" [%s]", options)
+			}
+			fmt.Println()
+		}
+		if count == 0 {
+			fmt.Println("  (no keys)")
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printKeysReport 打印每个目标的执行结果，labels 将脚本输出映射为可读的状态
+func printKeysReport(results []targetResult, labels map[string]string) {
+	failed := 0
+	for _, res := range results {
+		if res.err != nil {
+			failed++
+			fmt.Printf("  ❌ %s: %s\n", res.target, targetError(res))
+			continue
+		}
+		status := strings.TrimSpace(res.stdout)
+		if label, ok := labels[status]; ok {
+			status = label
+		}
+		fmt.Printf("  %s: %s\n", res.target, status)
+	}
+	fmt.Printf("--> %d succeeded, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func targetError(res targetResult) string {
+	if res.stderr != "" {
+		return res.stderr
+	}
+	return res.err.Error()
+}
+
+func init() {
+	for _, c := range []*cobra.Command{keysPushCmd, keysRevokeCmd, keysListCmd} {
+		c.Flags().String("cluster", "", "The name of the cluster")
+		c.MarkFlagRequired("cluster")
+		c.Flags().BoolVar(&keysSkipBastion, "skip-bastion", false, "Do not include the bastion itself")
+		addParallelFlag(c)
+		keysCmd.AddCommand(c)
+	}
+	keysPushCmd.Flags().StringVar(&keysKeyFile, "key", "", "Public key file to push")
+	keysRevokeCmd.Flags().StringVar(&keysKeyFile, "key", "", "Public key file to revoke")
+	keysRevokeCmd.Flags().StringVar(&keysFingerprint, "fingerprint", "", "Fingerprint (SHA256:...) of the key to revoke")
+}
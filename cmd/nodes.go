@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/gitlayzer/kgate/internal/config"
 	"github.com/manifoldco/promptui"
@@ -44,7 +45,25 @@ var nodesListCmd = &cobra.Command{
 		}
 		fmt.Printf("Nodes in cluster '%s':\n", clusterName)
 		for _, node := range targetCluster.Nodes {
-			fmt.Printf("- Alias: %s (Target: %s@%s)\n", node.Alias, node.User, node.IP)
+			status := ""
+			if node.Stale {
+				status = " [stale"
+				if node.LastSeen != nil {
+					status += ", last seen " + node.LastSeen.Local().Format("2006-01-02 15:04")
+				}
+				status += "]"
+			}
+			fmt.Printf("- Alias: %s (Target: %s@%s)%s\n", node.Alias, node.User, node.IP, status)
+			if len(node.Labels) > 0 {
+				keys := make([]string, 0, len(node.Labels))
+				for k := range node.Labels {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					fmt.Printf("    %s: %s\n", k, node.Labels[k])
+				}
+			}
 		}
 	},
 }
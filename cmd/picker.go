@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/manifoldco/promptui"
+	"golang.org/x/term"
+)
+
+// maxRecentNodes 是最近连接记录中保留的节点数量
+const maxRecentNodes = 20
+
+// pickerItem 是节点选择器中的一项
+type pickerItem struct {
+	Alias   string
+	IP      string
+	Cluster string
+	Labels  string
+	Recent  bool
+
+	node    *config.Node
+	cluster *config.Cluster
+	text    string // 模糊搜索的对象：别名、IP、集群和标签
+}
+
+// resolveNode 根据参数确定要连接的节点：完全匹配的别名直接返回，
+// 否则（包括没有参数）在终端中显示可模糊搜索的节点选择器。
+// 只有一个节点匹配时也要经过选择器确认，避免输错的别名悄悄连到另一个节点上
+func resolveNode(query string) (*config.Node, *config.Cluster, error) {
+	if query != "" {
+		if node, cluster, err := cfg.FindNode(query); err == nil {
+			return node, cluster, nil
+		}
+	}
+
+	var items []pickerItem
+	for _, item := range pickerItems() {
+		if fuzzyMatch(query, item.text) {
+			items = append(items, item)
+		}
+	}
+	switch {
+	case len(items) == 0 && query == "":
+		return nil, nil, fmt.Errorf("no nodes configured, add one with 'kgate nodes add'")
+	case len(items) == 0:
+		return nil, nil, fmt.Errorf("no node matches '%s'", query)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		switch {
+		case query == "":
+			return nil, nil, fmt.Errorf("a node alias is required when not running in a terminal")
+		case len(items) == 1:
+			return nil, nil, fmt.Errorf("no node with alias '%s' (did you mean '%s'?), please use an exact alias", query, items[0].Alias)
+		}
+		return nil, nil, fmt.Errorf("'%s' matches %d nodes, please use an exact alias", query, len(items))
+	}
+
+	label := "Select node"
+	if query != "" {
+		label = fmt.Sprintf("Select node matching '%s'", query)
+	}
+	prompt := promptui.Select{
+		Label: label,
+		Items: items,
+		Size:  10,
+		Templates: &promptui.SelectTemplates{
+			Label:    "{{ . }}",
+			Active:   `▸ {{ .Alias | cyan }}  {{ .IP }}  {{ .Cluster | faint }}{{ if .Recent }}  {{ "recent" | yellow }}{{ end }}`,
+			Inactive: `  {{ .Alias }}  {{ .IP }}  {{ .Cluster | faint }}{{ if .Recent }}  {{ "recent" | yellow }}{{ end }}`,
+			Selected: `{{ "✔" | green }} {{ .Alias }}`,
+			Details:  `{{ if .Labels }}{{ .Labels | faint }}{{ end }}`,
+		},
+		Searcher: func(input string, index int) bool {
+			return fuzzyMatch(input, items[index].text)
+		},
+		StartInSearchMode: true,
+	}
+	i, _, err := prompt.Run()
+	if err != nil {
+		return nil, nil, err
+	}
+	return items[i].node, items[i].cluster, nil
+}
+
+// pickerItems 列出所有集群中的节点，最近连接过的节点按时间排在最前面
+func pickerItems() []pickerItem {
+	rank := map[string]int{}
+	for i, alias := range recentNodes() {
+		rank[alias] = i + 1
+	}
+
+	var items []pickerItem
+	for i := range cfg.Clusters {
+		cluster := &cfg.Clusters[i]
+		for j := range cluster.Nodes {
+			node := &cluster.Nodes[j]
+			labels := make([]string, 0, len(node.Labels))
+			for k, v := range node.Labels {
+				labels = append(labels, k+"="+v)
+			}
+			sort.Strings(labels)
+			item := pickerItem{
+				Alias:   node.Alias,
+				IP:      node.IP,
+				Cluster: cluster.Name,
+				Labels:  strings.Join(labels, " "),
+				Recent:  rank[node.Alias] > 0,
+				node:    node,
+				cluster: cluster,
+			}
+			item.text = strings.Join([]string{item.Alias, item.IP, item.Cluster, item.Labels}, " ")
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(a, b int) bool {
+		ra, rb := rank[items[a].Alias], rank[items[b].Alias]
+		if ra == 0 || rb == 0 {
+			return ra != 0 && rb == 0
+		}
+		return ra < rb
+	})
+	return items
+}
+
+// fuzzyMatch 报告 text 是否包含 input 中的每个词，词中的字符按顺序出现即可，不区分大小写
+func fuzzyMatch(input, text string) bool {
+	text = strings.ToLower(text)
+	for _, word := range strings.Fields(strings.ToLower(input)) {
+		rest := text
+		for _, r := range word {
+			i := strings.IndexRune(rest, r)
+			if i < 0 {
+				return false
+			}
+			rest = rest[i+len(string(r)):]
+		}
+	}
+	return true
+}
+
+func recentNodesPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "recent_nodes"), nil
+}
+
+// recentNodes 返回最近连接过的节点别名，最近的在前
+func recentNodes() []string {
+	path, err := recentNodesPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+// recordRecentNode 把节点移到最近连接记录的最前面；记录失败不影响连接
+func recordRecentNode(alias string) {
+	path, err := recentNodesPath()
+	if err != nil {
+		return
+	}
+	aliases := []string{alias}
+	for _, a := range recentNodes() {
+		if a != alias && len(aliases) < maxRecentNodes {
+			aliases = append(aliases, a)
+		}
+	}
+	os.WriteFile(path, []byte(strings.Join(aliases, "\n")+"\n"), 0600)
+}
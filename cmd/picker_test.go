@@ -0,0 +1,28 @@
+package cmd
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	const text = "db-10 10.0.3.10 prod env=prod role=mysql"
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"", true},
+		{"db-10", true},
+		{"db1", true},
+		{"DB10", true},
+		{"prod mysql", true},
+		{"mysql prod", true},
+		{"10.0.3", true},
+		{"rolemysql", true},
+		{"web", false},
+		{"01bd", false},
+		{"db1 staging", false},
+	}
+	for _, tt := range tests {
+		if got := fuzzyMatch(tt.input, text); got != tt.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", tt.input, text, got, tt.want)
+		}
+	}
+}
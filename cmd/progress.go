@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// scanProgress 在终端上实时显示扫描进度：已扫描/总数、发现数量和预计剩余时间
+type scanProgress struct {
+	total   uint64
+	initial uint64 // 从检查点恢复时已经完成的数量，不计入本次的扫描速率
+	done    atomic.Uint64
+	found   atomic.Uint64
+	start   time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// startProgress 开始显示进度，stderr 不是终端时不显示任何内容
+func startProgress(total, done, found uint64) *scanProgress {
+	p := &scanProgress{total: total, initial: done, start: time.Now(), stop: make(chan struct{}), stopped: make(chan struct{})}
+	p.done.Store(done)
+	p.found.Store(found)
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		close(p.stopped)
+		return p
+	}
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.render()
+			case <-p.stop:
+				p.render()
+				fmt.Fprintln(os.Stderr)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *scanProgress) render() {
+	done, found := p.done.Load(), p.found.Load()
+	elapsed := time.Since(p.start)
+	line := fmt.Sprintf("\r\033[K--> 进度 %d/%d (%.1f%%)  发现 %d  已用 %s", done, p.total, percent(done, p.total), found, elapsed.Round(time.Second))
+	if scanned := done - p.initial; scanned > 0 && done < p.total {
+		eta := time.Duration(float64(elapsed) / float64(scanned) * float64(p.total-done))
+		line += fmt.Sprintf("  剩余约 %s", eta.Round(time.Second))
+	}
+	fmt.Fprint(os.Stderr, line)
+}
+
+// Stop 停止刷新并输出最后一次进度
+func (p *scanProgress) Stop() {
+	select {
+	case <-p.stopped:
+		return
+	default:
+	}
+	close(p.stop)
+	<-p.stopped
+}
+
+func percent(done, total uint64) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(done) * 100 / float64(total)
+}
+
+// transferProgress 在终端上实时显示传输进度：已传输/总字节数、速率和预计剩余时间
+type transferProgress struct {
+	total   int64
+	done    atomic.Int64
+	start   time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// startTransferProgress 开始显示传输进度，stderr 不是终端时不显示任何内容
+func startTransferProgress(total int64) *transferProgress {
+	p := &transferProgress{total: total, start: time.Now(), stop: make(chan struct{}), stopped: make(chan struct{})}
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		close(p.stopped)
+		return p
+	}
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.render()
+			case <-p.stop:
+				p.render()
+				fmt.Fprintln(os.Stderr)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Add 记录新传输的字节数，可以作为 transfer.Options.Progress 使用
+func (p *transferProgress) Add(n int64) {
+	p.done.Add(n)
+}
+
+func (p *transferProgress) render() {
+	done := p.done.Load()
+	elapsed := time.Since(p.start)
+	line := fmt.Sprintf("\r\033[K    %s / %s (%.1f%%)", formatBytes(done), formatBytes(p.total), percent(uint64(done), uint64(p.total)))
+	if secs := elapsed.Seconds(); secs > 0 {
+		rate := float64(done) / secs
+		line += fmt.Sprintf("  %s/s", formatBytes(int64(rate)))
+		if rate > 0 && done < p.total {
+			eta := time.Duration(float64(p.total-done) / rate * float64(time.Second))
+			line += fmt.Sprintf("  ETA %s", eta.Round(time.Second))
+		}
+	}
+	fmt.Fprint(os.Stderr, line)
+}
+
+// Stop 停止刷新并输出最后一次进度
+func (p *transferProgress) Stop() {
+	select {
+	case <-p.stopped:
+		return
+	default:
+	}
+	close(p.stop)
+	<-p.stopped
+}
+
+// formatBytes 以 1024 为进制格式化字节数，例如 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/transfer"
+)
+
+// remoteCopy 将一个节点上的文件或目录（可含通配符）复制到另一个节点的 destPath，目标路径按 resolveDestination 确定
+// 两个节点属于同一集群时，数据在跳板机上直接从源节点流向目标节点；
+// 否则（或者指定了 --limit 时）经由本机中转，两端各打开一个 SFTP 会话，数据不会写入本地磁盘
+func remoteCopy(srcAlias, srcPath, destAlias, destPath string) {
+	srcNode, srcCluster, err := cfg.FindNode(srcAlias)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	destNode, destCluster, err := cfg.FindNode(destAlias)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	srcPath, destPath = sftpPath(srcPath), sftpPath(destPath)
+
+	// 跳板机上的直接复制不经过本机，无法限速，指定 --limit 时改为经由本机中转
+	direct := srcCluster == destCluster && transferLimiter == nil
+	if err := requireStream(direct); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	// 两端的 SFTP 会话用于展开通配符和检查目标路径，中转时也用于传输数据
+	src, err := openSFTP(srcCluster, srcNode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", srcNode.Alias, err)
+		os.Exit(1)
+	}
+	defer src.Close()
+	dest, err := openSFTP(destCluster, destNode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", destNode.Alias, err)
+		os.Exit(1)
+	}
+	defer dest.Close()
+
+	sources, err := planRemoteSources(src, srcPath, sftpStat(dest), path.Join, path.Dir, destPath, scpMode())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if direct {
+		fmt.Printf("--> Copying %s:%s to %s:%s directly on bastion %s...\n", srcNode.Alias, srcPath, destNode.Alias, destPath, srcCluster.Name)
+		for _, s := range sources {
+			bastionCopy(srcCluster, srcNode, s.path, destNode, s.final)
+		}
+	} else {
+		fmt.Printf("--> Copying %s:%s (bastion %s) to %s:%s (bastion %s) through this machine...\n",
+			srcNode.Alias, srcPath, srcCluster.Name, destNode.Alias, destPath, destCluster.Name)
+		relayCopy(src, dest, remoteTarget{cluster: destCluster, node: destNode}, sources)
+	}
+	fmt.Println("✅ Transfer complete.")
+}
+
+// bastionCopy 在跳板机上把源节点 tar 打包的输出直接接到目标节点的 tar 解包，解包结果为 destPath
+func bastionCopy(cluster *config.Cluster, srcNode *config.Node, srcPath string, destNode *config.Node, destPath string) {
+	pack := compressedPipeline(fmt.Sprintf("tar cf - -C %s %s", shellQuote(path.Dir(srcPath)), shellQuote(path.Base(srcPath))), true)
+	srcCmd, err := nodeCommand(cluster, srcNode, nil, shellQuote(pack))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	destCmd, err := nodeCommand(cluster, destNode, nil, shellQuote(unpackScript(path.Base(srcPath), destPath)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	// pipefail 让源节点上的失败（例如路径不存在）也反映在退出状态中
+	script := fmt.Sprintf("set -o pipefail; (%s) | (%s)", srcCmd, destCmd)
+	bastionCmd, err := sshCommand(cluster, nil, "bash -c "+shellQuote(script))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	bastionCmd.Stdout = os.Stdout
+	bastionCmd.Stderr = os.Stderr
+	if err := bastionCmd.Run(); err != nil {
+		checkNodeHostKey(cluster, srcNode, err)
+		checkNodeHostKey(cluster, destNode, err)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if !verifyTransfers() {
+		return
+	}
+
+	want, err := remoteTreeChecksums(cluster, srcNode, path.Dir(srcPath), path.Base(srcPath))
+	if err == nil {
+		var got map[string]string
+		if got, err = remoteTreeChecksums(cluster, destNode, path.Dir(destPath), path.Base(destPath)); err == nil {
+			err = compareTrees(remoteTarget{cluster: cluster, node: destNode}.String(), want, got)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// relayCopy 在本机内存中把源节点上的文件转发到目标节点
+func relayCopy(src, dest *transfer.Client, destTarget remoteTarget, sources []remoteSource) {
+	var total int64
+	for _, s := range sources {
+		total += s.size
+	}
+
+	verifier := newTransferVerifier(destTarget, true)
+	progress := startTransferProgress(total)
+	var err error
+	for _, s := range sources {
+		if err = transfer.Copy(src, s.path, dest, s.final, verifier.options(transfer.Options{Progress: progress.Add, Limiter: transferLimiter})); err != nil {
+			break
+		}
+	}
+	progress.Stop()
+	if err == nil {
+		err = verifier.verify(func(f verifiedFile, opts transfer.Options) error {
+			return transfer.Copy(src, f.src, dest, f.dst, opts)
+		})
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
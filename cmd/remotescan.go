@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/scan"
+)
+
+// remoteScanScript 是在跳板机上运行的扫描脚本，参数依次为端口、并发数、每秒连接数上限和连接超时秒数
+// 目标地址从 stdin 逐行读入，结果逐行写到 stdout：
+//
+//	engine <nmap|bash>   使用的扫描方式
+//	ssh <ip> <banner>    端口开放且返回了 SSH 协议标识
+//	open <ip>            端口开放但不是 SSH 服务
+//
+// 安装了 nmap 时先用它快速筛选出开放端口的主机，再用 bash 的 /dev/tcp 读取协议标识；
+// 否则完全依靠 /dev/tcp 探测。建立连接最多等待连接超时，超时后由后台的计时进程终止探测；
+// 连接建立后再留出几秒读取协议标识，timeout 限制整个探测的总耗时
+const remoteScanScript = `port=$1 workers=$2 rate=$3 connect=$4
+probe=$(cat <<'EOF'
+( sleep "$3"; kill $$ ) 2>/dev/null &
+watchdog=$!
+exec 3<>"/dev/tcp/$1/$2"
+rc=$?
+kill $watchdog 2>/dev/null
+[ $rc -eq 0 ] || exit 0
+n=0
+while [ $n -lt 20 ] && IFS= read -r -t 3 line <&3; do
+  line=${line%$'\r'}
+  case $line in SSH-*) printf 'ssh %s %s\n' "$1" "$line"; exit 0;; esac
+  n=$((n+1))
+done
+printf 'open %s\n' "$1"
+EOF
+)
+delay=0
+[ "$rate" -gt 0 ] && delay=$(awk "BEGIN { printf \"%.4f\", 1 / $rate }")
+sweep() {
+  running=0
+  while IFS= read -r ip; do
+    [ -n "$ip" ] || continue
+    timeout $((connect + 5)) bash -c "$probe" kgate "$ip" "$port" "$connect" 2>/dev/null &
+    running=$((running + 1))
+    if [ "$running" -ge "$workers" ]; then wait -n; running=$((running - 1)); fi
+    [ "$delay" = 0 ] || sleep "$delay"
+  done
+  wait
+}
+if command -v nmap >/dev/null 2>&1; then
+  echo "engine nmap"
+  limit=
+  [ "$rate" -gt 0 ] && limit="--max-rate $rate"
+  nmap -n -Pn -sT -p "$port" --open --max-rtt-timeout "${connect}s" -oG - -iL - $limit 2>/dev/null | awk '/\/open\// { print $2; fflush() }' | sweep
+else
+  echo "engine bash"
+  sweep
+fi`
+
+// scanRemote 在跳板机上运行扫描，目标地址通过 stdin 流式发送，结果边扫描边读回
+// 取消 ctx 会终止 ssh 所在的进程组；跳板机上的脚本随后因 stdin 关闭而结束
+func scanRemote(ctx context.Context, cluster *config.Cluster, targets *scan.Targets) ([]discoveredHost, int, error) {
+	connect := int(math.Ceil(discoverTimeout.Seconds()))
+	remote := fmt.Sprintf("bash -c %s kgate %s %d %d %d",
+		shellQuote(remoteScanScript), shellQuote(discoverPort), discoverWorkers, discoverRate, connect)
+	scanCmd, err := sshCommand(cluster, nil, remote)
+	if err != nil {
+		return nil, 0, err
+	}
+	stdin, err := scanCmd.StdinPipe()
+	if err != nil {
+		return nil, 0, err
+	}
+	stdout, err := scanCmd.StdoutPipe()
+	if err != nil {
+		return nil, 0, err
+	}
+	stderr := &syncBuffer{}
+	scanCmd.Stderr = stderr
+	scanCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	fmt.Printf("--> 正在跳板机上扫描 %s 中的 %d 个主机，查找开放的端口 %s...\n", targets, targets.Count(), discoverPort)
+	if err := scanCmd.Start(); err != nil {
+		return nil, 0, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-scanCmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	go func() {
+		defer stdin.Close()
+		for ip := range targets.All() {
+			if ctx.Err() != nil {
+				return
+			}
+			if _, err := fmt.Fprintln(stdin, ip); err != nil {
+				return
+			}
+		}
+	}()
+
+	var (
+		hosts   []discoveredHost
+		skipped int
+	)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		kind, rest, _ := strings.Cut(scanner.Text(), " ")
+		ip, bannerLine, _ := strings.Cut(rest, " ")
+		switch kind {
+		case "engine":
+			fmt.Printf("--> 跳板机使用 %s 进行扫描\n", rest)
+		case "ssh":
+			banner, err := scan.ParseBanner(bannerLine)
+			if err != nil {
+				skipped++
+				continue
+			}
+			fmt.Printf("  发现 %-15s %s\n", ip, banner)
+			hosts = append(hosts, discoveredHost{IP: canonicalIP(ip), Banner: banner})
+		case "open":
+			skipped++
+		}
+	}
+	err = scanCmd.Wait()
+	if ctx.Err() != nil {
+		return nil, 0, ctx.Err()
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.String() != "" {
+			err = fmt.Errorf("%v: %s", err, stderr.String())
+		}
+		return nil, 0, fmt.Errorf("在跳板机上扫描时出错: %w", err)
+	}
+	sortHosts(hosts)
+
+	if discoverFingerprint && len(hosts) > 0 {
+		addFingerprints(cluster, hosts)
+	}
+	return hosts, skipped, nil
+}
+
+// addFingerprints 在跳板机上用 ssh-keyscan 取得主机公钥，并记录每台主机的首选密钥指纹
+func addFingerprints(cluster *config.Cluster, hosts []discoveredHost) {
+	ips := make([]string, len(hosts))
+	for i, host := range hosts {
+		ips[i] = host.IP
+	}
+	keys, err := scanNodeKeys(cluster, ips...)
+	if err != nil {
+		fmt.Printf("--> 获取主机公钥指纹失败: %v\n", err)
+		return
+	}
+	for i := range hosts {
+		found := keys[hosts[i].IP]
+		for _, key := range found {
+			if key.Type == "ssh-ed25519" {
+				hosts[i].Fingerprint = key.Fingerprint()
+			}
+		}
+		if hosts[i].Fingerprint == "" && len(found) > 0 {
+			hosts[i].Fingerprint = found[0].Fingerprint()
+		}
+	}
+}
@@ -25,6 +25,12 @@ through multiple bastion hosts without complex ssh_config files.`,
 }
 
 func Execute() {
+	if isAskpassInvocation() {
+		runAskpass(os.Args[1:])
+		return
+	}
+	// 放在这里而不是 init 中，此时所有子命令都已经注册
+	registerClusterCompletions(rootCmd)
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -40,6 +46,12 @@ func init() {
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(nodesCmd)
 	rootCmd.AddCommand(scpCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(browseCmd)
+	rootCmd.AddCommand(secretCmd)
+	rootCmd.AddCommand(hostkeysCmd)
+	rootCmd.AddCommand(caCmd)
+	rootCmd.AddCommand(keysCmd)
 	rootCmd.SetVersionTemplate(fmt.Sprintf("{{.Use}} version %s (built on %s)\n", version, buildDate))
 }
 
@@ -1,37 +1,77 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/transfer"
 	"github.com/spf13/cobra"
 )
 
-var recursive bool
+var (
+	recursive bool
+	scpTar    bool
+	scpResume bool
+	scpForce  bool
+)
 
 var scpCmd = &cobra.Command{
-	Use:   "scp [-r] [source] [destination]",
+	Use:   "scp [-r] [--force] [source] [destination]",
 	Short: "Copy files between a local machine and a remote node",
 	Long: `Securely copies files or directories using the bastion's own keys.
-One path must be local, and the other remote.
-A remote path is specified with the syntax: [node-alias]:/path/to/file`,
+At least one path must be remote; a remote path is specified with the
+syntax: [node-alias]:/path/to/file ('node-alias:' alone is the home directory).
+
+The destination follows scp: when it is an existing directory the source is
+copied into it, otherwise the source is copied to that path (renaming it).
+Directories require -r, and existing files are only overwritten with --force.
+Remote sources may contain wildcards (node:/var/log/*.log, quote them for the
+local shell); several matches require an existing destination directory.
+
+When both paths are remote the data never touches the local disk: nodes of
+the same cluster copy directly on the bastion (tar on both nodes), nodes of
+different clusters are relayed through this machine over SFTP.
+
+The node part may also select several nodes: a comma-separated list of
+aliases, alias patterns (web-*) or labels (role=web). Uploads are then sent
+to all selected nodes in parallel, reading the local source only once, and
+downloads are saved per node under [destination]/[node-alias]/.
+
+Files are transferred over SFTP tunnelled through the bastion, keeping file
+modes and modification times. Data is written to a temporary '.kgate-part'
+file first; an interrupted transfer can be continued with --resume.
+Use --tar to stream a tar archive instead (requires tar on both ends).
+
+--limit caps the transfer rate (e.g. 10M per second) so that large transfers
+do not saturate the bastion's uplink; copies between nodes of the same
+cluster are then relayed through this machine. --compress compresses data in
+transit: gzip uses ssh compression for SFTP, while tar streams are compressed
+with gzip or zstd (the zstd command is needed on both ends).`,
 	Args: cobra.ExactArgs(2),
 	Run:  runScp,
+
+	ValidArgsFunction: completeTransferArg,
 }
 
 // parseScpArg 解析 scp 参数，判断其是否为远程路径
 // 返回: 别名, 路径, 是否为远程路径
+// 冒号前含有 / 的参数（如 ./a:b）视为本地路径，"alias:" 表示远端家目录
 func parseScpArg(arg string) (alias, path string, isRemote bool) {
-	parts := strings.SplitN(arg, ":", 2)
-	if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
-		return parts[0], parts[1], true
+	alias, path, found := strings.Cut(arg, ":")
+	if !found || alias == "" || strings.Contains(alias, "/") {
+		return arg, "", false
+	}
+	if path == "" {
+		path = "."
 	}
-	return arg, "", false
+	return alias, path, true
 }
 
 func runScp(cmd *cobra.Command, args []string) {
@@ -41,10 +81,22 @@ func runScp(cmd *cobra.Command, args []string) {
 	srcAlias, srcPath, srcIsRemote := parseScpArg(source)
 	destAlias, destPath, destIsRemote := parseScpArg(destination)
 
-	if srcIsRemote == destIsRemote {
-		fmt.Fprintln(os.Stderr, "Error: One path must be local and one must be remote (e.g., 'node-alias:/path').")
+	if !srcIsRemote && !destIsRemote {
+		fmt.Fprintln(os.Stderr, "Error: At least one path must be remote (e.g., 'node-alias:/path').")
 		os.Exit(1)
 	}
+	if err := parseBandwidthFlags(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if srcIsRemote && destIsRemote {
+		if isNodeSelector(srcAlias) || isNodeSelector(destAlias) {
+			fmt.Fprintln(os.Stderr, "Error: Copying between nodes requires a single source and destination node.")
+			os.Exit(1)
+		}
+		remoteCopy(srcAlias, srcPath, destAlias, destPath)
+		return
+	}
 
 	// 查找节点和跳板机信息
 	var nodeAlias string
@@ -53,7 +105,14 @@ func runScp(cmd *cobra.Command, args []string) {
 	} else {
 		nodeAlias = destAlias
 	}
+	if isNodeSelector(nodeAlias) {
+		runScpMany(nodeAlias, source, destination, srcIsRemote)
+		return
+	}
 	node, cluster, err := cfg.FindNode(nodeAlias)
+	if err == nil {
+		err = requireStream(scpTar)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
@@ -61,33 +120,208 @@ func runScp(cmd *cobra.Command, args []string) {
 
 	fmt.Printf("--> Transferring files via bastion %s using bastion's key...\n", cluster.Name)
 
-	if !srcIsRemote { // --- UPLOAD ---
-		localPath := source
-		remotePath := destPath
-		upload(&cluster.Bastion, node, localPath, remotePath)
-	} else { // --- DOWNLOAD ---
-		remotePath := srcPath
-		localPath := destination
-		download(&cluster.Bastion, node, remotePath, localPath)
+	switch {
+	case scpTar && !srcIsRemote:
+		upload(cluster, node, source, destPath)
+	case scpTar:
+		download(cluster, node, srcPath, destination)
+	case !srcIsRemote:
+		sftpUpload(cluster, node, source, destPath)
+	default:
+		sftpDownload(cluster, node, srcPath, destination)
 	}
 
 	fmt.Println("✅ Transfer complete.")
 }
 
+// runScpMany 处理选中多个节点的传输：上传时分发到所有节点，下载时每个节点保存到 destination/<alias>/ 下
+func runScpMany(selector, source, destination string, srcIsRemote bool) {
+	if scpTar {
+		fmt.Fprintln(os.Stderr, "Error: --tar can only be used with a single node.")
+		os.Exit(1)
+	}
+	targets, err := selectNodes(selector)
+	if err == nil {
+		err = requireStream(false)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if srcIsRemote {
+		_, remotePath, _ := parseScpArg(source)
+		fanInDownload(targets, remotePath, destination)
+		return
+	}
+	// 多节点上传把同一份数据同时写给所有节点，各节点中断的位置不同，无法从各自的临时文件续传
+	if scpResume {
+		fmt.Fprintln(os.Stderr, "Error: --resume is not supported when uploading to multiple nodes; resume each node with a single-node upload instead.")
+		os.Exit(1)
+	}
+	_, remoteDest, _ := parseScpArg(destination)
+	fanOutUpload(targets, source, remoteDest)
+}
+
+// openSFTP 经由跳板机打开到节点 sftp 子系统的会话
+func openSFTP(cluster *config.Cluster, node *config.Node) (*transfer.Client, error) {
+	if err := pinNodeKey(cluster, node); err != nil {
+		return nil, err
+	}
+	remote, err := nodeCommand(cluster, node, append(sshCompressionArgs(), "-s"), "sftp")
+	if err != nil {
+		return nil, err
+	}
+	sshCmd, err := sshCommand(cluster, nil, remote)
+	if err != nil {
+		return nil, err
+	}
+	client, err := transfer.Open(sshCmd)
+	var sessionErr *transfer.SessionError
+	if errors.As(err, &sessionErr) {
+		checkNodeHostKey(cluster, node, sessionErr.Err)
+	}
+	return client, err
+}
+
+// sftpPath 将 scp 风格的远端路径转换为 sftp 路径：sftp 的相对路径以登录用户的家目录为起点
+func sftpPath(p string) string {
+	if p == "~" || p == "~/" {
+		return "."
+	}
+	return strings.TrimPrefix(p, "~/")
+}
+
+// sftpUpload 通过 SFTP 将本地文件或目录上传到远端路径 remoteDest，目标路径按 resolveDestination 确定
+func sftpUpload(cluster *config.Cluster, node *config.Node, localPath, remoteDest string) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	total, err := transfer.LocalSize(localPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	client, err := openSFTP(cluster, node)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	dest, err := resolveDestination(sftpStat(client), path.Join, path.Dir, sftpPath(remoteDest), filepath.Base(localPath), info.IsDir(), false, scpMode())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", node.Alias, err)
+		os.Exit(1)
+	}
+
+	verifier := newTransferVerifier(remoteTarget{cluster: cluster, node: node}, true)
+	progress := startTransferProgress(total)
+	err = client.Upload(localPath, dest, verifier.options(transfer.Options{Resume: scpResume, Progress: progress.Add, Limiter: transferLimiter}))
+	progress.Stop()
+	if err != nil {
+		transferFailed(err)
+	}
+	err = verifier.verify(func(f verifiedFile, opts transfer.Options) error {
+		return client.Upload(f.src, f.dst, opts)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// sftpDownload 通过 SFTP 下载远端文件或目录（可含通配符）到本地路径 localDest，目标路径按 resolveDestination 确定
+func sftpDownload(cluster *config.Cluster, node *config.Node, remotePattern, localDest string) {
+	client, err := openSFTP(cluster, node)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	// 先确定所有源的目标路径，任何一个不满足条件都不开始传输
+	sources, err := planRemoteSources(client, sftpPath(remotePattern), localStat, filepath.Join, filepath.Dir, localDest, scpMode())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", node.Alias, err)
+		os.Exit(1)
+	}
+	var total int64
+	for _, src := range sources {
+		total += src.size
+	}
+
+	verifier := newTransferVerifier(remoteTarget{cluster: cluster, node: node}, false)
+	progress := startTransferProgress(total)
+	for _, src := range sources {
+		if err = client.Download(src.path, src.final, verifier.options(transfer.Options{Resume: scpResume, Progress: progress.Add, Limiter: transferLimiter, OnSkip: warnSkipped})); err != nil {
+			break
+		}
+	}
+	progress.Stop()
+	if err != nil {
+		transferFailed(err)
+	}
+	err = verifier.verify(func(f verifiedFile, opts transfer.Options) error {
+		return client.Download(f.src, f.dst, opts)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// transferFailed 报告传输错误并退出，未完成的数据保留在临时文件中以便续传
+func transferFailed(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	if !scpResume {
+		fmt.Fprintf(os.Stderr, "Partially transferred files are kept as '*%s'; run the same command with --resume to continue.\n", transfer.PartSuffix)
+	}
+	os.Exit(1)
+}
+
+// warnSkipped 报告下载时因不安全而跳过的远端条目，例如指向目标目录之外的符号链接
+func warnSkipped(remote string, err error) {
+	fmt.Fprintf(os.Stderr, "Warning: skipped %s: %v\n", remote, err)
+}
+
 // upload handles file uploads using 'tar' over a double SSH pipe.
-func upload(bastion *config.Bastion, node *config.Node, localPath, remotePath string) {
+func upload(cluster *config.Cluster, node *config.Node, localPath, remotePath string) {
 	localDir := filepath.Dir(localPath)
 	localFile := filepath.Base(localPath)
+	info, err := os.Stat(localPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 
-	remoteNodeCmd := fmt.Sprintf("ssh %s@%s \"mkdir -p %s && tar xf - -C %s\"", node.User, node.IP, remotePath, remotePath)
+	if err := pinNodeKey(cluster, node); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	// tar 模式没有 SFTP 会话，目标路径的状态一次性在节点上查询
+	remotePath = sftpPath(remotePath)
+	stat, err := remoteStat(cluster, node, remotePath, path.Dir(remotePath), path.Join(remotePath, localFile))
+	if err == nil {
+		remotePath, err = resolveDestination(stat, path.Join, path.Dir, remotePath, localFile, info.IsDir(), false, scpMode())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", node.Alias, err)
+		os.Exit(1)
+	}
+
+	remoteNodeCmd, err := nodeCommand(cluster, node, nil, shellQuote(unpackScript(localFile, remotePath)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 
-	bastionAddr := fmt.Sprintf("%s@%s", bastion.User, bastion.Host)
-	sshArgs := []string{}
-	if bastion.IdentityFile != "" {
-		sshArgs = append(sshArgs, "-i", bastion.IdentityFile)
+	bastionCmd, err := sshCommand(cluster, nil, remoteNodeCmd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
 	}
-	sshArgs = append(sshArgs, bastionAddr, remoteNodeCmd)
-	bastionCmd := exec.Command("ssh", sshArgs...)
 
 	// --- 核心修改点 ---
 	// 智能判断是否需要添加 --no-xattr 标志来消除 macOS 上的警告
@@ -98,12 +332,12 @@ func upload(bastion *config.Bastion, node *config.Node, localPath, remotePath st
 	}
 	localCmd := exec.Command("tar", tarArgs...)
 
-	var err error
-	bastionCmd.Stdin, err = localCmd.StdoutPipe()
+	tarOut, err := localCmd.StdoutPipe()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating stdout pipe for local tar: %v\n", err)
 		os.Exit(1)
 	}
+	bastionCmd.Stdin = transfer.CompressStream(tarOut, compression, transferLimiter)
 	bastionCmd.Stdout = os.Stdout
 	bastionCmd.Stderr = os.Stderr
 
@@ -112,63 +346,141 @@ func upload(bastion *config.Bastion, node *config.Node, localPath, remotePath st
 		os.Exit(1)
 	}
 	if err := bastionCmd.Run(); err != nil {
+		checkNodeHostKey(cluster, node, err)
 		os.Exit(1)
 	}
 	if err := localCmd.Wait(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error waiting for local tar command: %v\n", err)
 		os.Exit(1)
 	}
+	if verifyTransfers() {
+		verifyTar(cluster, node, localPath, remotePath, true)
+	}
+}
+
+// verifyTar 比较 tar 传输前后两端所有文件的 SHA-256，不一致时退出
+func verifyTar(cluster *config.Cluster, node *config.Node, localPath, remotePath string, upload bool) {
+	local, err := localTreeChecksums(filepath.Dir(localPath), filepath.Base(localPath))
+	if err == nil {
+		var remote map[string]string
+		remote, err = remoteTreeChecksums(cluster, node, path.Dir(remotePath), path.Base(remotePath))
+		if err == nil {
+			label := remoteTarget{cluster: cluster, node: node}.String()
+			if upload {
+				err = compareTrees(label, local, remote)
+			} else {
+				err = compareTrees(label, remote, local)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 }
 
 // download handles file downloads using 'tar' over a double SSH pipe.
-func download(bastion *config.Bastion, node *config.Node, remotePath, localPath string) {
-	remoteDir := filepath.Dir(remotePath)
-	remoteFile := filepath.Base(remotePath)
+func download(cluster *config.Cluster, node *config.Node, remotePath, localPath string) {
+	remotePath = sftpPath(remotePath)
+	if strings.ContainsAny(remotePath, "*?[") {
+		fmt.Fprintln(os.Stderr, "Error: --tar does not support wildcards in the remote path.")
+		os.Exit(1)
+	}
+	remoteDir := path.Dir(remotePath)
+	remoteFile := path.Base(remotePath)
 
-	remoteNodeCmd := fmt.Sprintf("ssh %s@%s \"tar cf - -C %s %s\"", node.User, node.IP, remoteDir, remoteFile)
+	if err := pinNodeKey(cluster, node); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	stat, err := remoteStat(cluster, node, remotePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	exists, isDir := stat(remotePath)
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Error: %s: %s: no such file or directory\n", node.Alias, remotePath)
+		os.Exit(1)
+	}
+	dest, err := resolveDestination(localStat, filepath.Join, filepath.Dir, localPath, remoteFile, isDir, false, scpMode())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 
-	bastionAddr := fmt.Sprintf("%s@%s", bastion.User, bastion.Host)
-	sshArgs := []string{}
-	if bastion.IdentityFile != "" {
-		sshArgs = append(sshArgs, "-i", bastion.IdentityFile)
+	pack := compressedPipeline(fmt.Sprintf("tar cf - -C %s %s", shellQuote(remoteDir), shellQuote(remoteFile)), true)
+	remoteNodeCmd, err := nodeCommand(cluster, node, nil, shellQuote(pack))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
 	}
-	sshArgs = append(sshArgs, bastionAddr, remoteNodeCmd)
-	bastionCmd := exec.Command("ssh", sshArgs...)
 
-	// 智能判断本地解压目录
-	destDir := "." // 默认解压到当前目录
-	info, err := os.Stat(localPath)
-	if err == nil && info.IsDir() {
-		// 如果用户提供的路径是一个已存在的目录，则使用该目录
-		destDir = localPath
+	bastionCmd, err := sshCommand(cluster, nil, remoteNodeCmd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	// 名称不变时直接解包到目标的上级目录；需要重命名时先解包到同一目录下的临时目录，完成后再移动到位
+	extractDir := filepath.Dir(dest)
+	var tmpDir string
+	if filepath.Base(dest) != remoteFile {
+		if tmpDir, err = os.MkdirTemp(extractDir, ".kgate-"); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		extractDir = tmpDir
+	}
+	fail := func(format string, args ...any) {
+		if tmpDir != "" {
+			os.RemoveAll(tmpDir)
+		}
+		fmt.Fprintf(os.Stderr, format, args...)
+		os.Exit(1)
 	}
 
 	// 本地命令：从 stdin 解压 tar 包到正确的目录
-	localCmd := exec.Command("tar", "xf", "-", "-C", destDir)
+	localCmd := exec.Command("tar", "xf", "-", "-C", extractDir)
 
 	// --- 管道连接逻辑保持不变 ---
-	localCmd.Stdin, err = bastionCmd.StdoutPipe()
+	bastionOut, err := bastionCmd.StdoutPipe()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating stdout pipe for bastion ssh: %v\n", err)
-		os.Exit(1)
+		fail("Error creating stdout pipe for bastion ssh: %v\n", err)
 	}
+	localCmd.Stdin = transfer.DecompressStream(bastionOut, compression, transferLimiter)
 	localCmd.Stdout = os.Stdout
 	localCmd.Stderr = os.Stderr
 
 	if err := bastionCmd.Start(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error starting bastion ssh command: %v\n", err)
-		os.Exit(1)
+		fail("Error starting bastion ssh command: %v\n", err)
 	}
 	if err := localCmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error during local tar execution: %v\n", err)
-		os.Exit(1)
+		fail("Error during local tar execution: %v\n", err)
 	}
 	if err := bastionCmd.Wait(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error waiting for bastion ssh command: %v\n", err)
-		os.Exit(1)
+		checkNodeHostKey(cluster, node, err)
+		fail("Error waiting for bastion ssh command: %v\n", err)
+	}
+	if tmpDir != "" {
+		if err := os.RemoveAll(dest); err != nil {
+			fail("Error: %v\n", err)
+		}
+		if err := os.Rename(filepath.Join(tmpDir, remoteFile), dest); err != nil {
+			fail("Error: %v\n", err)
+		}
+		os.RemoveAll(tmpDir)
+	}
+	if verifyTransfers() {
+		verifyTar(cluster, node, dest, remotePath, false)
 	}
 }
 
 func init() {
-	scpCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Recursively copy entire directories (default for tar)")
+	scpCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Recursively copy entire directories")
+	scpCmd.Flags().BoolVar(&scpForce, "force", false, "Overwrite existing files at the destination")
+	scpCmd.Flags().BoolVar(&scpTar, "tar", false, "Stream a tar archive over ssh instead of using SFTP")
+	scpCmd.Flags().BoolVar(&scpResume, "resume", false, "Continue interrupted transfers from their '.kgate-part' files (not supported for uploads to multiple nodes)")
+	addVerifyFlags(scpCmd, " (SFTP only)")
+	addBandwidthFlags(scpCmd)
 }
@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/secret"
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// kgate 在连接时会使用的 secret 名称
+const (
+	secretBastionPassphrase = "bastion-passphrase"
+	secretSudoPassword      = "sudo-password"
+)
+
+// masterKey 缓存本次运行中已获取的主密钥材料
+var masterKey []byte
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage encrypted secrets stored in the config",
+	Long: `Stores sensitive values such as a bastion key passphrase or a sudo password
+encrypted (AES-256-GCM) in config.yaml. Values are only decrypted in memory when needed.
+
+Recognised secret names:
+  bastion-passphrase   passphrase of the bastion identity file
+  sudo-password        password used by 'kgate exec --sudo'
+
+The master key is read from $KGATE_MASTER_KEYFILE, ~/.config/.kgate/master.key
+(see 'kgate secret keygen'), $KGATE_MASTER_PASSPHRASE, or prompted for.`,
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set [cluster] [name]",
+	Short: "Encrypt and store a secret for a cluster",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster, err := cfg.FindCluster(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		value, err := readSecretValue(fmt.Sprintf("Value for '%s'", args[1]))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Prompt failed %v\n", err)
+			os.Exit(1)
+		}
+		key, err := loadEncryptionKey()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		encrypted, err := secret.Encrypt(key, value, secretContext(cluster.Name, args[1]))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if cluster.Secrets == nil {
+			cluster.Secrets = map[string]string{}
+		}
+		cluster.Secrets[args[1]] = encrypted
+		if err := cfg.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Secret '%s' stored for cluster '%s'.\n", args[1], cluster.Name)
+	},
+}
+
+var secretGetCmd = &cobra.Command{
+	Use:   "get [cluster] [name]",
+	Short: "Decrypt and print a secret, or list secret names when no name is given",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster, err := cfg.FindCluster(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if len(args) == 1 {
+			var names []string
+			for name := range cluster.Secrets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Println(name)
+			}
+			return
+		}
+		value, ok, err := clusterSecret(cluster, args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: secret '%s' not found in cluster '%s'\n", args[1], cluster.Name)
+			os.Exit(1)
+		}
+		fmt.Println(value)
+	},
+}
+
+var secretRmCmd = &cobra.Command{
+	Use:   "rm [cluster] [name]",
+	Short: "Remove a secret from a cluster",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster, err := cfg.FindCluster(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if _, ok := cluster.Secrets[args[1]]; !ok {
+			fmt.Fprintf(os.Stderr, "Error: secret '%s' not found in cluster '%s'\n", args[1], cluster.Name)
+			os.Exit(1)
+		}
+		delete(cluster.Secrets, args[1])
+		if err := cfg.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Secret '%s' removed from cluster '%s'.\n", args[1], cluster.Name)
+	},
+}
+
+var secretKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a random master key file instead of using a passphrase",
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := masterKeyPath()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(path); err == nil {
+			fmt.Fprintf(os.Stderr, "Error: %s already exists\n", path)
+			os.Exit(1)
+		}
+		key, err := secret.NewKey()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(path, []byte(key), 0600); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Master key written to %s. Keep a backup, secrets cannot be recovered without it.\n", path)
+	},
+}
+
+// clusterSecret 解密集群中名为 name 的 secret，不存在时 ok 为 false
+func clusterSecret(cluster *config.Cluster, name string) (value string, ok bool, err error) {
+	encrypted, ok := cluster.Secrets[name]
+	if !ok {
+		return "", false, nil
+	}
+	key, err := loadMasterKey()
+	if err != nil {
+		return "", false, err
+	}
+	value, err = secret.Decrypt(key, encrypted, secretContext(cluster.Name, name))
+	if err != nil {
+		return "", false, fmt.Errorf("secret '%s' of cluster '%s': %w", name, cluster.Name, err)
+	}
+	return value, true, nil
+}
+
+// secretContext 是加密时绑定的附加数据，使密文只能在原来的集群和名称下解密
+func secretContext(cluster, name string) string {
+	return cluster + "/" + name
+}
+
+func masterKeyPath() (string, error) {
+	if path := os.Getenv("KGATE_MASTER_KEYFILE"); path != "" {
+		return path, nil
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "master.key"), nil
+}
+
+// masterKeyAvailable 报告 loadMasterKey 能否不经交互输入就取得主密钥材料
+func masterKeyAvailable() bool {
+	if masterKey != nil || os.Getenv("KGATE_MASTER_PASSPHRASE") != "" {
+		return true
+	}
+	path, err := masterKeyPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// loadMasterKey 按密钥文件、环境变量、交互输入的顺序获取主密钥材料
+func loadMasterKey() ([]byte, error) {
+	if masterKey != nil {
+		return masterKey, nil
+	}
+	path, err := masterKeyPath()
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		masterKey = []byte(strings.TrimSpace(string(data)))
+		return masterKey, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if passphrase := os.Getenv("KGATE_MASTER_PASSPHRASE"); passphrase != "" {
+		masterKey = []byte(passphrase)
+		return masterKey, nil
+	}
+
+	passphrase, err := promptMasterPassphrase("Master passphrase")
+	if err != nil {
+		return nil, err
+	}
+	masterKey = []byte(passphrase)
+	return masterKey, nil
+}
+
+// loadEncryptionKey 获取加密新 secret 使用的主密钥材料，避免输错的主口令加密出以后无法解密的值：
+// 配置中已有 secret 时主密钥必须能解密它；没有可对照的 secret 时，交互输入的主口令要输入两次
+func loadEncryptionKey() ([]byte, error) {
+	for i := range cfg.Clusters {
+		cluster := &cfg.Clusters[i]
+		for name := range cluster.Secrets {
+			if _, _, err := clusterSecret(cluster, name); err != nil {
+				masterKey = nil
+				if errors.Is(err, secret.ErrDecrypt) {
+					return nil, fmt.Errorf("the master key does not match the existing secret '%s' of cluster '%s'", name, cluster.Name)
+				}
+				return nil, err
+			}
+			return loadMasterKey()
+		}
+	}
+	if masterKeyAvailable() {
+		return loadMasterKey()
+	}
+
+	passphrase, err := promptMasterPassphrase("New master passphrase")
+	if err != nil {
+		return nil, err
+	}
+	confirm, err := promptMasterPassphrase("Repeat master passphrase")
+	if err != nil {
+		return nil, err
+	}
+	if confirm != passphrase {
+		return nil, errors.New("master passphrases do not match")
+	}
+	masterKey = []byte(passphrase)
+	return masterKey, nil
+}
+
+// promptMasterPassphrase 以掩码方式读取主口令
+func promptMasterPassphrase(label string) (string, error) {
+	prompt := promptui.Prompt{Label: label, Mask: '*'}
+	passphrase, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("empty master passphrase")
+	}
+	return passphrase, nil
+}
+
+// readSecretValue 在终端中以掩码方式读取 secret，否则从标准输入读取
+func readSecretValue(label string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	prompt := promptui.Prompt{Label: label, Mask: '*'}
+	return prompt.Run()
+}
+
+func init() {
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretGetCmd)
+	secretCmd.AddCommand(secretRmCmd)
+	secretCmd.AddCommand(secretKeygenCmd)
+}
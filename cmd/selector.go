@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// isNodeSelector 判断 scp 等命令中的节点部分是否可能选中多个节点
+func isNodeSelector(spec string) bool {
+	return strings.ContainsAny(spec, ",*?[=")
+}
+
+// selectNodes 解析节点选择器并返回所有匹配的节点，顺序与配置文件一致
+// 选择器由逗号分隔的多个条件组成，满足任意一个条件的节点都会被选中，条件可以是：
+//
+//	web-01        节点别名
+//	web-*         别名通配符，语法同 path.Match
+//	role=web      标签，节点的 labels 中 role 的值为 web
+//
+// 通配符和标签不会选中被 discover 标记为 stale 的节点
+func selectNodes(selector string) ([]remoteTarget, error) {
+	var terms []string
+	for _, term := range strings.Split(selector, ",") {
+		if term = strings.TrimSpace(term); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty node selector")
+	}
+	for _, term := range terms {
+		if strings.ContainsAny(term, "*?[=") {
+			if _, err := path.Match(term, ""); err != nil {
+				return nil, fmt.Errorf("invalid node pattern '%s': %w", term, err)
+			}
+			continue
+		}
+		if _, _, err := cfg.FindNode(term); err != nil {
+			return nil, err
+		}
+	}
+
+	var targets []remoteTarget
+	for i := range cfg.Clusters {
+		cluster := &cfg.Clusters[i]
+		for j := range cluster.Nodes {
+			node := &cluster.Nodes[j]
+			for _, term := range terms {
+				if matchNode(term, node.Alias, node.Labels, node.Stale) {
+					targets = append(targets, remoteTarget{cluster: cluster, node: node})
+					break
+				}
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no nodes match '%s'", selector)
+	}
+	return targets, nil
+}
+
+func matchNode(term, alias string, labels map[string]string, stale bool) bool {
+	if key, value, ok := strings.Cut(term, "="); ok {
+		v, found := labels[key]
+		return !stale && found && v == value
+	}
+	if !strings.ContainsAny(term, "*?[") {
+		return term == alias
+	}
+	ok, _ := path.Match(term, alias)
+	return ok && !stale
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gitlayzer/kgate/internal/config"
+)
+
+// socksProxy 是一个在后台运行、经由跳板机转发的 SSH SOCKS 代理 (ssh -N -D)
+type socksProxy struct {
+	Addr   string
+	pid    int
+	stderr *syncBuffer
+	done   chan struct{}
+}
+
+// syncBuffer 是一个可以在 ssh 写入的同时被读取的缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.TrimSpace(b.buf.String())
+}
+
+// startSocksProxy 在一个空闲的本地端口上启动 SOCKS 代理，并等待它可用
+// 若 ssh 提前退出、等待超时或 ctx 被取消，返回的错误中会包含 ssh 的错误输出
+func startSocksProxy(ctx context.Context, cluster *config.Cluster, timeout time.Duration) (*socksProxy, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("分配本地端口失败: %w", err)
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	// ExitOnForwardFailure 保证端口被抢占时 ssh 立即退出，而不是在没有代理的情况下继续运行
+	proxyCmd, err := sshCommand(cluster, []string{"-N", "-D", addr, "-o", "ExitOnForwardFailure=yes"})
+	if err != nil {
+		return nil, err
+	}
+	p := &socksProxy{Addr: addr, stderr: &syncBuffer{}, done: make(chan struct{})}
+	proxyCmd.Stderr = p.stderr
+	proxyCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true} // Crucial for killing the process group
+	if err := proxyCmd.Start(); err != nil {
+		return nil, err
+	}
+	p.pid = proxyCmd.Process.Pid
+	go func() {
+		proxyCmd.Wait()
+		close(p.done)
+	}()
+
+	if err := p.waitReady(ctx, timeout); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// waitReady 不断探测 SOCKS 监听端口，直到完成一次 SOCKS5 握手
+func (p *socksProxy) waitReady(ctx context.Context, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if socksHandshake(p.Addr) == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.done:
+			return fmt.Errorf("SSH 代理意外退出: %s", p.stderrOr("无错误输出"))
+		case <-deadline.C:
+			return fmt.Errorf("等待 SSH 代理就绪超时 (%s): %s", timeout, p.stderrOr("跳板机没有响应"))
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *socksProxy) stderrOr(fallback string) string {
+	if msg := p.stderr.String(); msg != "" {
+		return msg
+	}
+	return fallback
+}
+
+// Close 终止 ssh 所在的整个进程组，并等待其退出
+func (p *socksProxy) Close() error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	err := syscall.Kill(-p.pid, syscall.SIGKILL)
+	<-p.done
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
+
+// socksHandshake 发送一个无认证的 SOCKS5 问候，用于确认监听者确实是 ssh 的代理
+func socksHandshake(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 || reply[1] != 0x00 {
+		return fmt.Errorf("unexpected SOCKS reply %v", reply)
+	}
+	return nil
+}
+
+// freePort 向内核申请一个当前空闲的本地端口
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/hostkeys"
+	"github.com/gitlayzer/kgate/internal/sshkey"
+	"github.com/spf13/cobra"
+)
+
+// bastionAddr 返回跳板机的 user@host 地址
+func bastionAddr(cluster *config.Cluster) string {
+	return fmt.Sprintf("%s@%s", cluster.Bastion.User, cluster.Bastion.Host)
+}
+
+// nodeAddr 返回节点的 user@ip 地址
+func nodeAddr(node *config.Node) string {
+	return fmt.Sprintf("%s@%s", node.User, node.IP)
+}
+
+// agentWarned 记录本次运行中已经提示过 agent 转发风险的集群
+var agentWarned = map[string]bool{}
+
+// nodeCommand 返回在跳板机上执行的、连接节点并运行 command 的 shell 命令
+// 节点的主机密钥由 kgate 固定：固定的公钥会写入跳板机上的临时 known_hosts 文件，
+// 内层 ssh 以 StrictHostKeyChecking=yes 校验，而不是依赖跳板机自己的 known_hosts。
+// 密钥必须已经固定，首次连接的调用方应先调用 pinNodeKey
+func nodeCommand(cluster *config.Cluster, node *config.Node, opts []string, command string) (string, error) {
+	keys, err := pinnedNodeKeys(cluster, node)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, shellQuote(node.IP+" "+key.Type+" "+key.Blob))
+	}
+
+	args := []string{"ssh", "-o", `UserKnownHostsFile="$kh"`, "-o", "GlobalKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=yes"}
+	args = append(args, opts...)
+	if cluster.Bastion.ForwardAgent {
+		args = append(args, "-A")
+	}
+	args = append(args, nodeAddr(node))
+	if command != "" {
+		args = append(args, command)
+	}
+
+	return fmt.Sprintf(`kh=$(mktemp) && printf '%%s\n' %s > "$kh" && %s; rc=$?; rm -f "$kh"; exit $rc`,
+		strings.Join(lines, " "), strings.Join(args, " ")), nil
+}
+
+// bastionArgs 返回连接跳板机时的认证和 agent 转发相关参数
+// cert 非空时使用 CA 签发的短期证书进行认证。是否转发 agent 始终由 ForwardAgent 决定：
+// 开启时转发的是只持有这张证书的专用 agent，节点上的内层 ssh 也可以用证书认证；
+// 关闭时证书只用于登录跳板机，内层 ssh 与不使用证书时一样使用跳板机自己的密钥
+func bastionArgs(cluster *config.Cluster, cert *certSession) ([]string, error) {
+	var args []string
+	if cluster.Bastion.ForwardAgent {
+		if !agentWarned[cluster.Name] {
+			fmt.Fprintf(os.Stderr, "⚠️  Agent forwarding is enabled for cluster '%s': anyone with root on the bastion or node can use your agent keys while connected.\n", cluster.Name)
+			agentWarned[cluster.Name] = true
+		}
+		args = append(args, "-A")
+	} else {
+		args = append(args, "-a")
+	}
+
+	// 跳板机的主机密钥首次连接时自动固定到 kgate 的 known_hosts 中，之后发生变化将拒绝连接
+	knownHosts, err := hostkeys.BastionPath()
+	if err != nil {
+		return nil, err
+	}
+	knownHostsFiles := sshOptionQuote(knownHosts)
+	if home, err := os.UserHomeDir(); err == nil {
+		knownHostsFiles += " " + sshOptionQuote(filepath.Join(home, ".ssh", "known_hosts"))
+	}
+	args = append(args,
+		"-o", "UserKnownHostsFile="+knownHostsFiles,
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "HashKnownHosts=no",
+	)
+
+	switch {
+	case cert != nil:
+		// 私钥在专用 agent 中，-i 指定公钥即可让 ssh 只使用这把密钥
+		args = append(args, "-i", cert.pubKey, "-o", "CertificateFile="+sshOptionQuote(cert.cert), "-o", "IdentitiesOnly=yes")
+	case cluster.Bastion.AgentKey != "":
+		path, err := agentKeyFile(cluster.Bastion.AgentKey)
+		if err != nil {
+			return nil, fmt.Errorf("cluster '%s': %w", cluster.Name, err)
+		}
+		// 指定公钥并设置 IdentitiesOnly，ssh 只会使用 agent 中对应的那把私钥
+		args = append(args, "-i", path, "-o", "IdentitiesOnly=yes")
+	case cluster.Bastion.IdentityFile != "":
+		args = append(args, "-i", cluster.Bastion.IdentityFile)
+	}
+	return args, nil
+}
+
+// sshOptionQuote 将路径转义为 ssh -o 选项值中的一项，路径中可以包含空格
+// ssh 会展开选项值中的 % 标记，因此也需要转义 %
+func sshOptionQuote(p string) string {
+	return `"` + strings.ReplaceAll(p, "%", "%%") + `"`
+}
+
+// agentKeyFile 将 ssh-agent 中指纹匹配的公钥写入文件，并返回文件路径
+func agentKeyFile(fingerprint string) (string, error) {
+	key, err := sshkey.FindAgentKey(fingerprint)
+	if err != nil {
+		return "", err
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "agent")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer("/", "_", "+", "-").Replace(strings.TrimPrefix(key.Fingerprint(), "SHA256:"))
+	path := filepath.Join(dir, name+".pub")
+	if err := os.WriteFile(path, []byte(key.String()+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// sshCommand 构建一个连接到集群跳板机的 ssh 命令
+// opts 是放在跳板机地址之前的 ssh 选项，remote 是在跳板机上执行的命令
+func sshCommand(cluster *config.Cluster, opts []string, remote ...string) (*exec.Cmd, error) {
+	var cert *certSession
+	if cluster.Certificate != nil {
+		var err error
+		if cert, err = clusterCertificate(cluster); err != nil {
+			return nil, fmt.Errorf("issuing certificate for cluster '%s': %w", cluster.Name, err)
+		}
+	}
+
+	auth, err := bastionArgs(cluster, cert)
+	if err != nil {
+		return nil, err
+	}
+	args := append(append([]string{}, opts...), auth...)
+	args = append(args, bastionAddr(cluster))
+	args = append(args, remote...)
+
+	cmd := exec.Command("ssh", args...)
+	if cert != nil {
+		cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+cert.socket)
+		return cmd, nil
+	}
+	passphrase, ok, err := clusterSecret(cluster, secretBastionPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		// 通过 askpass 将口令交给 ssh，避免它出现在命令行参数、环境变量或磁盘上
+		env, err := askpassEnv(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd, nil
+}
+
+// remoteTarget 是批量操作中的一个目标：集群的跳板机本身或其中的一个节点
+type remoteTarget struct {
+	cluster *config.Cluster
+	node    *config.Node // 为 nil 表示跳板机
+}
+
+func (t remoteTarget) String() string {
+	if t.node == nil {
+		return "bastion " + t.cluster.Bastion.Host
+	}
+	return fmt.Sprintf("%s (%s)", t.node.Alias, t.node.IP)
+}
+
+// command 返回在目标上执行 script 的 ssh 命令
+func (t remoteTarget) command(script string) (*exec.Cmd, error) {
+	if t.node == nil {
+		return sshCommand(t.cluster, nil, script)
+	}
+	remote, err := nodeCommand(t.cluster, t.node, nil, shellQuote(script))
+	if err != nil {
+		return nil, err
+	}
+	return sshCommand(t.cluster, nil, remote)
+}
+
+// targetResult 是在某个目标上执行脚本的结果
+type targetResult struct {
+	target remoteTarget
+	stdout string
+	stderr string
+	err    error
+}
+
+// targetParallelism 是 runOnTargets 同时执行的目标数量上限，由 --parallel 设置。
+// 每个目标都是一条到跳板机的 ssh 连接，跳板机 sshd 默认的 MaxStartups 10:30:100
+// 会在未完成认证的连接超过 10 条时开始随机丢弃新连接
+var targetParallelism = 8
+
+// addParallelFlag 为使用 runOnTargets 的命令注册 --parallel
+func addParallelFlag(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&targetParallelism, "parallel", 8, "Maximum number of targets to connect to at the same time")
+}
+
+// runOnTargets 在所有目标上并行执行 script（最多同时 targetParallelism 个），结果的顺序与 targets 一致
+// 首次连接时的主机密钥固定和命令构建都在启动前按顺序完成，不会并发执行
+func runOnTargets(targets []remoteTarget, script func(remoteTarget) string) []targetResult {
+	results := make([]targetResult, len(targets))
+	cmds := make([]*exec.Cmd, len(targets))
+	for i, t := range targets {
+		results[i].target = t
+		if t.node != nil {
+			if results[i].err = pinNodeKey(t.cluster, t.node); results[i].err != nil {
+				continue
+			}
+		}
+		cmds[i], results[i].err = t.command(script(t))
+	}
+
+	slots := make(chan struct{}, max(targetParallelism, 1))
+	var wg sync.WaitGroup
+	for i := range targets {
+		if cmds[i] == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			var stdout, stderr strings.Builder
+			cmds[i].Stdout = &stdout
+			cmds[i].Stderr = &stderr
+			results[i].err = cmds[i].Run()
+			results[i].stdout = stdout.String()
+			results[i].stderr = strings.TrimSpace(stderr.String())
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// shellQuote 将字符串转义为可以安全传递给远程 shell 的单个参数
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/transfer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncDelete   bool
+	syncExclude  []string
+	syncDryRun   bool
+	syncChecksum bool
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [source-dir] [destination-dir]",
+	Short: "Incrementally synchronise a directory with a remote node",
+	Long: `Makes the destination directory match the source directory, transferring
+only files that are new or have changed. One side must be local and the other
+remote ([node-alias]:/path/to/dir). The contents of the source directory are
+synchronised into the destination directory, which is created if needed.
+
+Files are compared by size and modification time, or by SHA-256 with
+--checksum. Transfers go over SFTP through the bastion and keep file modes and
+modification times. --limit caps the transfer rate and --compress gzip enables
+ssh compression.`,
+	Example: `  kgate sync ./dist web-01:/opt/app --delete --exclude '*.map'
+  kgate sync web-01:/var/log/app ./logs --dry-run`,
+	Args: cobra.ExactArgs(2),
+	Run:  runSync,
+
+	ValidArgsFunction: completeTransferArg,
+}
+
+// syncSide 封装同步目标一端的文件操作，上传和下载共用同一套执行流程
+type syncSide struct {
+	copy      func(rel string, opts transfer.Options) error // 从源端复制一个文件或符号链接
+	mkdir     func(rel string, mode fs.FileMode) error
+	remove    func(e transfer.Entry) error
+	removeAll func(rel string) error
+	chtimes   func(rel string, t time.Time) error
+}
+
+func runSync(cmd *cobra.Command, args []string) {
+	srcAlias, srcPath, srcIsRemote := parseScpArg(args[0])
+	destAlias, destPath, destIsRemote := parseScpArg(args[1])
+	if srcIsRemote == destIsRemote {
+		fmt.Fprintln(os.Stderr, "Error: One path must be local and one must be remote (e.g., 'node-alias:/path').")
+		os.Exit(1)
+	}
+
+	alias, localRoot, remoteRoot := destAlias, args[0], destPath
+	if srcIsRemote {
+		alias, localRoot, remoteRoot = srcAlias, args[1], srcPath
+	}
+	remoteRoot = sftpPath(remoteRoot)
+	node, cluster, err := cfg.FindNode(alias)
+	if err == nil {
+		err = parseBandwidthFlags()
+	}
+	if err == nil {
+		err = requireStream(false)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if !srcIsRemote {
+		if info, err := os.Stat(localRoot); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: source '%s' is not a directory.\n", localRoot)
+			os.Exit(1)
+		}
+	}
+
+	client, err := openSFTP(cluster, node)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	fmt.Printf("--> Comparing %s with %s:%s via bastion %s...\n", localRoot, node.Alias, remoteRoot, cluster.Name)
+	excludes := transfer.Excludes(syncExclude)
+	localTree, err := transfer.LocalTree(localRoot, excludes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	remoteTree, err := client.RemoteTree(remoteRoot, excludes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s on %s: %v\n", remoteRoot, node.Alias, err)
+		os.Exit(1)
+	}
+	if srcIsRemote && len(remoteTree) == 0 {
+		if info, err := client.Stat(remoteRoot); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: source '%s:%s' is not a directory.\n", node.Alias, remoteRoot)
+			os.Exit(1)
+		}
+	}
+
+	src, dst := localTree, remoteTree
+	side := remoteSyncSide(client, localRoot, remoteRoot)
+	if srcIsRemote {
+		src, dst = remoteTree, localTree
+		side = localSyncSide(client, remoteRoot, localRoot)
+	}
+
+	changed := transfer.ChangedBySizeAndTime
+	if syncChecksum {
+		changed, err = checksumComparer(cluster, node, localRoot, remoteRoot, src, dst)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+	plan := transfer.Diff(src, dst, changed)
+	if !syncDelete {
+		plan.Delete = nil
+	}
+
+	printSyncPlan(plan)
+	if plan.Empty() {
+		fmt.Printf("✅ Already in sync (%d unchanged).\n", plan.Unchanged)
+		return
+	}
+	if syncDryRun {
+		fmt.Printf("Dry run: would add %d, update %d and delete %d entries, transferring %s (%d unchanged).\n",
+			len(plan.Add), len(plan.Update), len(plan.Delete), formatBytes(plan.Bytes()), plan.Unchanged)
+		return
+	}
+
+	verifier := newTransferVerifier(remoteTarget{cluster: cluster, node: node}, !srcIsRemote)
+	failed := applySyncPlan(plan, src, dst, side, verifier.options(transfer.Options{Limiter: transferLimiter}))
+	err = verifier.verify(func(f verifiedFile, opts transfer.Options) error {
+		if srcIsRemote {
+			return client.Download(f.src, f.dst, opts)
+		}
+		return client.Upload(f.src, f.dst, opts)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		failed++
+	}
+	summary := fmt.Sprintf("%d added, %d updated, %d deleted, %d unchanged, %s transferred",
+		len(plan.Add), len(plan.Update), len(plan.Delete), plan.Unchanged, formatBytes(plan.Bytes()))
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "❌ Sync finished with %d error(s): %s.\n", failed, summary)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Sync complete: %s.\n", summary)
+}
+
+// checksumComparer 计算两边大小相同的文件的 SHA-256，返回按内容比较文件的函数
+// 大小不同的文件一定需要传输，不必计算校验和
+func checksumComparer(cluster *config.Cluster, node *config.Node, localRoot, remoteRoot string, src, dst transfer.Tree) (func(s, d transfer.Entry) bool, error) {
+	var candidates []string
+	for p, s := range src {
+		if d, ok := dst[p]; ok && s.IsRegular() && d.IsRegular() && s.Size == d.Size {
+			candidates = append(candidates, p)
+		}
+	}
+	fmt.Printf("--> Computing checksums of %d file(s)...\n", len(candidates))
+	remoteSums, err := remoteChecksums(cluster, node, remoteRoot, candidates)
+	if err != nil {
+		return nil, err
+	}
+	localSums := map[string]string{}
+	for _, p := range candidates {
+		sum, err := transfer.FileSHA256(filepath.Join(localRoot, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, err
+		}
+		localSums[p] = sum
+	}
+
+	return func(s, d transfer.Entry) bool {
+		if s.Size != d.Size {
+			return true
+		}
+		remote, ok := remoteSums[s.Path]
+		return !ok || remote != localSums[s.Path]
+	}, nil
+}
+
+func printSyncPlan(plan *transfer.Plan) {
+	name := func(e transfer.Entry) string {
+		if e.IsDir() {
+			return e.Path + "/"
+		}
+		return e.Path
+	}
+	for _, e := range plan.Add {
+		fmt.Printf("  + %s\n", name(e))
+	}
+	for _, e := range plan.Update {
+		fmt.Printf("  ~ %s\n", name(e))
+	}
+	for _, e := range plan.Delete {
+		fmt.Printf("  - %s\n", name(e))
+	}
+}
+
+// applySyncPlan 执行同步计划，单个条目失败时报告错误并继续，返回失败的数量
+// opts 是复制每个文件时使用的传输选项，进度显示由这里设置
+func applySyncPlan(plan *transfer.Plan, src, dst transfer.Tree, side syncSide, opts transfer.Options) int {
+	failed := 0
+	fail := func(p string, err error) {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", p, err)
+		failed++
+	}
+
+	if err := side.mkdir("", 0755); err != nil {
+		fail(".", err)
+		return failed
+	}
+
+	progress := startTransferProgress(plan.Bytes())
+	opts.Progress = progress.Add
+	for _, list := range [][]transfer.Entry{plan.Add, plan.Update} {
+		for _, e := range list {
+			// 类型发生变化的条目（例如文件变成了目录）先删除旧的
+			if old, ok := dst[e.Path]; ok && old.Mode.Type() != e.Mode.Type() {
+				if err := side.removeAll(old.Path); err != nil {
+					fail(e.Path, err)
+					continue
+				}
+			}
+			var err error
+			if e.IsDir() {
+				err = side.mkdir(e.Path, e.Mode.Perm())
+			} else {
+				err = side.copy(e.Path, opts)
+			}
+			if err != nil {
+				fail(e.Path, err)
+			}
+		}
+	}
+	progress.Stop()
+
+	for _, e := range plan.Delete {
+		if err := side.remove(e); err != nil {
+			fail(e.Path, err)
+		}
+	}
+	// 目录的修改时间在其内容写完之后再设置，由内向外
+	paths := src.Paths()
+	for i := len(paths) - 1; i >= 0; i-- {
+		if e := src[paths[i]]; e.IsDir() {
+			side.chtimes(e.Path, e.ModTime)
+		}
+	}
+	return failed
+}
+
+// remoteSyncSide 返回把本地 localRoot 同步到远端 remoteRoot 时的目标端操作
+func remoteSyncSide(client *transfer.Client, localRoot, remoteRoot string) syncSide {
+	remote := func(rel string) string { return path.Join(remoteRoot, rel) }
+	return syncSide{
+		copy: func(rel string, opts transfer.Options) error {
+			return client.Upload(filepath.Join(localRoot, filepath.FromSlash(rel)), remote(rel), opts)
+		},
+		mkdir: func(rel string, mode fs.FileMode) error {
+			if err := client.MkdirAll(remote(rel)); err != nil {
+				return err
+			}
+			if rel == "" {
+				return nil
+			}
+			return client.Chmod(remote(rel), mode)
+		},
+		remove: func(e transfer.Entry) error {
+			if e.IsDir() {
+				return client.RemoveDirectory(remote(e.Path))
+			}
+			return client.Remove(remote(e.Path))
+		},
+		removeAll: func(rel string) error {
+			return client.RemoveAll(remote(rel))
+		},
+		chtimes: func(rel string, t time.Time) error {
+			return client.Chtimes(remote(rel), t, t)
+		},
+	}
+}
+
+// localSyncSide 返回把远端 remoteRoot 同步到本地 localRoot 时的目标端操作
+func localSyncSide(client *transfer.Client, remoteRoot, localRoot string) syncSide {
+	local := func(rel string) string { return filepath.Join(localRoot, filepath.FromSlash(rel)) }
+	return syncSide{
+		copy: func(rel string, opts transfer.Options) error {
+			// 每个条目单独下载，写入的边界是整个同步目录
+			opts.Root, opts.OnSkip = localRoot, warnSkipped
+			return client.Download(path.Join(remoteRoot, rel), local(rel), opts)
+		},
+		mkdir: func(rel string, mode fs.FileMode) error {
+			if err := os.MkdirAll(local(rel), 0755); err != nil {
+				return err
+			}
+			if rel == "" {
+				return nil
+			}
+			return os.Chmod(local(rel), mode)
+		},
+		remove: func(e transfer.Entry) error {
+			return os.Remove(local(e.Path))
+		},
+		removeAll: func(rel string) error {
+			return os.RemoveAll(local(rel))
+		},
+		chtimes: func(rel string, t time.Time) error {
+			return os.Chtimes(local(rel), t, t)
+		},
+	}
+}
+
+func init() {
+	syncCmd.Flags().BoolVar(&syncDelete, "delete", false, "Delete files in the destination that do not exist in the source")
+	syncCmd.Flags().StringSliceVar(&syncExclude, "exclude", nil, "Skip paths matching a glob pattern (repeatable, e.g. '*.log' or 'build/tmp')")
+	syncCmd.Flags().BoolVarP(&syncDryRun, "dry-run", "n", false, "Show what would change without transferring anything")
+	syncCmd.Flags().BoolVarP(&syncChecksum, "checksum", "c", false, "Compare files by SHA-256 instead of size and modification time")
+	addVerifyFlags(syncCmd, "")
+	addBandwidthFlags(syncCmd)
+}
@@ -0,0 +1,109 @@
+package ca
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gitlayzer/kgate/internal/config"
+)
+
+// DefaultTTL 是未配置有效期时证书的默认有效期
+const DefaultTTL = time.Hour
+
+// KeyPath 返回 CA 私钥路径，未配置时使用 ~/.config/.kgate/ca/ca
+func KeyPath(c *config.CA) (string, error) {
+	if c != nil && c.KeyFile != "" {
+		return expandHome(c.KeyFile)
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ca", "ca"), nil
+}
+
+// Init 生成新的 CA 密钥对
+func Init(keyPath string) error {
+	if _, err := os.Stat(keyPath); err == nil {
+		return fmt.Errorf("CA key %s already exists", keyPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return err
+	}
+	return sshKeygen("-q", "-t", "ed25519", "-N", "", "-C", "kgate-ca", "-f", keyPath)
+}
+
+// NewKey 在 dir 中生成一把没有口令的临时密钥，返回私钥路径
+func NewKey(dir, name string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	for _, p := range []string{path, path + ".pub", path + "-cert.pub"} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	if err := sshKeygen("-q", "-t", "ed25519", "-N", "", "-C", name, "-f", path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Sign 使用 CA 私钥为公钥签发证书，返回证书路径（<key>-cert.pub）
+func Sign(caKey, pubKey, identity string, principals []string, ttl time.Duration) (string, error) {
+	if _, err := os.Stat(caKey); err != nil {
+		return "", fmt.Errorf("CA key not found, run 'kgate ca init' first: %w", err)
+	}
+	if len(principals) == 0 {
+		return "", errors.New("at least one principal is required")
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	// 将开始时间提前一分钟，以容忍各主机之间的时钟偏差
+	validity := fmt.Sprintf("-1m:+%ds", int(ttl.Seconds()))
+	if err := sshKeygen("-q", "-s", caKey, "-I", identity, "-n", strings.Join(principals, ","), "-V", validity, pubKey); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(pubKey, ".pub") + "-cert.pub", nil
+}
+
+// ParseTTL 解析有效期配置，为空时返回默认值
+func ParseTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return DefaultTTL, nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid certificate ttl %q: %w", s, err)
+	}
+	return ttl, nil
+}
+
+func sshKeygen(args ...string) error {
+	cmd := exec.Command("ssh-keygen", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ssh-keygen: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
@@ -4,18 +4,47 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Clusters []Cluster `yaml:"clusters"`
+	Clusters  []Cluster  `yaml:"clusters"`
+	Inventory *Inventory `yaml:"inventory,omitempty"`
+	CA        *CA        `yaml:"ca,omitempty"`
+}
+
+// CA 描述用于签发短期 SSH 证书的本地 CA
+type CA struct {
+	KeyFile string `yaml:"keyFile,omitempty"` // 默认为 ~/.config/.kgate/ca/ca
+	TTL     string `yaml:"ttl,omitempty"`     // 默认有效期，例如 30m
+}
+
+// Inventory 描述团队共享的 git 清单仓库
+type Inventory struct {
+	Remote string `yaml:"remote"`
+	Branch string `yaml:"branch,omitempty"`
+	File   string `yaml:"file,omitempty"`
 }
 
 type Cluster struct {
-	Name    string  `yaml:"name"`
-	Bastion Bastion `yaml:"bastion"`
-	Nodes   []Node  `yaml:"nodes,omitempty"`
+	Name    string            `yaml:"name"`
+	Bastion Bastion           `yaml:"bastion"`
+	Nodes   []Node            `yaml:"nodes,omitempty"`
+	Secrets map[string]string `yaml:"secrets,omitempty"` // 加密后的敏感信息，见 kgate secret
+	// Certificate 非空时，每次连接前都会用本地 CA 签发一张短期证书。证书总是用于登录跳板机，
+	// 只有开启 Bastion.ForwardAgent 时节点上的内层 ssh 才能通过转发的 agent 使用它
+	Certificate *Certificate `yaml:"certificate,omitempty"`
+	// AliasTemplate 是 discover 为新节点生成别名时使用的 text/template 模板，
+	// 可以引用 .Hostname、.Cluster、.IP、.LastOctet 和 .Labels，例如 "{{.Cluster}}-{{.LastOctet}}"
+	AliasTemplate string `yaml:"aliasTemplate,omitempty"`
+}
+
+// Certificate 描述集群使用的短期证书
+type Certificate struct {
+	Principals []string `yaml:"principals,omitempty"` // 默认为跳板机和所有节点的用户名
+	TTL        string   `yaml:"ttl,omitempty"`        // 覆盖 CA 的默认有效期
 }
 
 type Bastion struct {
@@ -23,20 +52,54 @@ type Bastion struct {
 	User         string `yaml:"user"`
 	Port         int    `yaml:"port,omitempty"`
 	IdentityFile string `yaml:"identityFile,omitempty"`
+	// AgentKey 指定使用 ssh-agent 中指纹匹配的密钥（例如 SHA256:...），优先于 IdentityFile
+	AgentKey string `yaml:"agentKey,omitempty"`
+	// ForwardAgent 控制是否将本地 ssh-agent 转发到跳板机和节点，默认关闭
+	ForwardAgent bool `yaml:"forwardAgent,omitempty"`
 }
 
 type Node struct {
-	Alias string `yaml:"alias"`
-	IP    string `yaml:"ip"`
-	User  string `yaml:"user"`
+	Alias  string            `yaml:"alias"`
+	IP     string            `yaml:"ip"`
+	User   string            `yaml:"user"`
+	Labels map[string]string `yaml:"labels,omitempty"` // 例如 discover --facts 收集到的主机信息
+	// Stale 表示节点在 discover --mark-stale 时位于扫描范围内却没有响应
+	Stale    bool       `yaml:"stale,omitempty"`
+	LastSeen *time.Time `yaml:"lastSeen,omitempty"` // 最近一次在 discover 对账中被发现在线的时间
+	Forwards []Forward  `yaml:"forwards,omitempty"` // discover --ports 发现的节点服务
 }
 
-func GetConfigPath() (string, error) {
+// Forward 是 discover 在节点上发现的一个命名服务端口，只作为记录保存，kgate 不会据此建立转发
+type Forward struct {
+	Name       string `yaml:"name"`
+	RemotePort int    `yaml:"remotePort"`
+	Service    string `yaml:"service,omitempty"` // discover 识别出的服务类型，如 postgres
+}
+
+// Dir 返回 kgate 存放配置和状态文件的目录
+func Dir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, ".config", ".kgate", "config.yaml"), nil
+	return filepath.Join(home, ".config", ".kgate"), nil
+}
+
+func GetConfigPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// Parse 解析 YAML 格式的配置内容
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
 }
 
 func Load() (*Config, error) {
@@ -59,9 +122,7 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
-	var cfg Config
-	err = yaml.Unmarshal(data, &cfg)
-	return &cfg, err
+	return Parse(data)
 }
 
 func (c *Config) Save() error {
@@ -98,11 +159,12 @@ func (c *Config) FindCluster(name string) (*Cluster, error) {
 	return nil, fmt.Errorf("cluster with name '%s' not found", name)
 }
 
-func (c *Cluster) AddNode(alias, ip, user string) {
+func (c *Cluster) AddNode(alias, ip, user string) *Node {
 	newNode := Node{
 		Alias: alias,
 		IP:    ip,
 		User:  user,
 	}
 	c.Nodes = append(c.Nodes, newNode)
+	return &c.Nodes[len(c.Nodes)-1]
 }
@@ -0,0 +1,36 @@
+package facts
+
+import (
+	"strings"
+)
+
+// Script 是在节点上收集主机信息的 shell 脚本，每行输出一个 key=value
+// 只依赖 POSIX shell 和常见的系统工具，缺失的信息输出为空值
+const Script = `echo "hostname=$(hostname 2>/dev/null)"
+if [ -r /etc/os-release ]; then (. /etc/os-release; echo "os=$PRETTY_NAME"); else echo "os=$(uname -s)"; fi
+echo "kernel=$(uname -r)"
+echo "arch=$(uname -m)"
+echo "cpus=$(nproc 2>/dev/null || getconf _NPROCESSORS_ONLN 2>/dev/null)"
+awk '/^MemTotal:/ { printf "memory=%.1fGi\n", $2 / 1048576 }' /proc/meminfo 2>/dev/null
+echo "interfaces=$(ip -o addr show scope global 2>/dev/null | awk '{ printf "%s%s=%s", sep, $2, $4; sep = "," }')"`
+
+// Keys 是 Script 会输出的信息，按展示顺序排列
+var Keys = []string{"hostname", "os", "kernel", "arch", "cpus", "memory", "interfaces"}
+
+// Parse 解析 Script 的输出，忽略空值和无法识别的行
+func Parse(out string) map[string]string {
+	facts := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || value == "" {
+			continue
+		}
+		for _, k := range Keys {
+			if k == key {
+				facts[key] = value
+				break
+			}
+		}
+	}
+	return facts
+}
@@ -0,0 +1,209 @@
+package hostkeys
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"github.com/gitlayzer/kgate/internal/sshkey"
+)
+
+// Entry 是 known_hosts 文件中的一行
+type Entry struct {
+	Hosts []string
+	Key   *sshkey.PublicKey
+	raw   string // 无法解析的行（注释、哈希主机名、@cert-authority 等）原样保留
+}
+
+// File 是一个 known_hosts 格式的文件
+type File struct {
+	Path    string
+	Entries []Entry
+}
+
+// BastionPath 返回 kgate 管理的跳板机 known_hosts 文件路径
+func BastionPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "known_hosts"), nil
+}
+
+// NodePath 返回某个集群节点的 known_hosts 文件路径
+// 不同集群的内网地址可能重叠，因此节点主机密钥按集群分别保存
+func NodePath(cluster string) (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "known_hosts.d", cluster), nil
+}
+
+// Load 读取 known_hosts 文件，文件不存在时返回空文件
+func Load(path string) (*File, error) {
+	f := &File{Path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		f.Entries = append(f.Entries, parseLine(scanner.Text()))
+	}
+	return f, scanner.Err()
+}
+
+func parseLine(line string) Entry {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "@") || strings.HasPrefix(trimmed, "|") {
+		return Entry{raw: line}
+	}
+	fields := strings.SplitN(trimmed, " ", 2)
+	if len(fields) != 2 {
+		return Entry{raw: line}
+	}
+	key, err := sshkey.Parse(fields[1])
+	if err != nil {
+		return Entry{raw: line}
+	}
+	return Entry{Hosts: strings.Split(fields[0], ","), Key: key}
+}
+
+// Lookup 返回为 host 固定的所有公钥
+func (f *File) Lookup(host string) []*sshkey.PublicKey {
+	var keys []*sshkey.PublicKey
+	for _, e := range f.Entries {
+		if e.Key != nil && contains(e.Hosts, host) {
+			keys = append(keys, e.Key)
+		}
+	}
+	return keys
+}
+
+// Hosts 返回文件中出现的所有主机
+func (f *File) Hosts() []string {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, e := range f.Entries {
+		for _, h := range e.Hosts {
+			if !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	return hosts
+}
+
+// Add 为 host 固定一把公钥，已存在的相同公钥会被忽略
+func (f *File) Add(host string, key *sshkey.PublicKey) {
+	for _, k := range f.Lookup(host) {
+		if k.Type == key.Type && k.Blob == key.Blob {
+			return
+		}
+	}
+	f.Entries = append(f.Entries, Entry{Hosts: []string{host}, Key: &sshkey.PublicKey{Type: key.Type, Blob: key.Blob}})
+}
+
+// Forget 删除 host 的所有公钥，返回删除的条目数
+func (f *File) Forget(host string) int {
+	var kept []Entry
+	removed := 0
+	for _, e := range f.Entries {
+		if e.Key == nil || !contains(e.Hosts, host) {
+			kept = append(kept, e)
+			continue
+		}
+		removed++
+		if len(e.Hosts) > 1 {
+			e.Hosts = remove(e.Hosts, host)
+			kept = append(kept, e)
+		}
+	}
+	f.Entries = kept
+	return removed
+}
+
+// Save 将文件写回磁盘
+func (f *File) Save() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, e := range f.Entries {
+		b.WriteString(e.String())
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(f.Path, []byte(b.String()), 0600)
+}
+
+// String 返回 known_hosts 格式的一行
+func (e Entry) String() string {
+	if e.Key == nil {
+		return e.raw
+	}
+	return strings.Join(e.Hosts, ",") + " " + e.Key.Type + " " + e.Key.Blob
+}
+
+// ParseScan 解析 ssh-keyscan 的输出，按主机分组返回公钥
+func ParseScan(output string) map[string][]*sshkey.PublicKey {
+	keys := map[string][]*sshkey.PublicKey{}
+	for _, line := range strings.Split(output, "\n") {
+		e := parseLine(line)
+		if e.Key == nil {
+			continue
+		}
+		for _, h := range e.Hosts {
+			keys[h] = append(keys[h], e.Key)
+		}
+	}
+	return keys
+}
+
+// Changed 判断扫描到的公钥是否与固定的公钥冲突
+// 只有同一类型的公钥不一致才视为变化，新出现的类型不算冲突
+func Changed(pinned, presented []*sshkey.PublicKey) (was, now *sshkey.PublicKey) {
+	for _, p := range presented {
+		var sameType *sshkey.PublicKey
+		matched := false
+		for _, k := range pinned {
+			if k.Type != p.Type {
+				continue
+			}
+			sameType = k
+			if k.Blob == p.Blob {
+				matched = true
+				break
+			}
+		}
+		if sameType != nil && !matched {
+			return sameType, p
+		}
+	}
+	return nil, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(list []string, s string) []string {
+	var out []string
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,294 @@
+package inventory
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gitlayzer/kgate/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultBranch = "main"
+	defaultFile   = "inventory.yaml"
+)
+
+// Conflict 描述个人配置与团队清单中同名节点（或跳板机）之间的差异
+type Conflict struct {
+	Cluster string
+	Alias   string // 为空表示冲突发生在跳板机上
+	Field   string
+	Local   string
+	Remote  string
+}
+
+func (c Conflict) String() string {
+	target := c.Cluster + "/bastion"
+	if c.Alias != "" {
+		target = c.Cluster + "/" + c.Alias
+	}
+	return fmt.Sprintf("%s: %s differs (local: %q, inventory: %q)", target, c.Field, c.Local, c.Remote)
+}
+
+// Result 汇总一次合并的结果
+type Result struct {
+	AddedClusters int
+	AddedNodes    int
+	Conflicts     []Conflict
+}
+
+// Repo 是团队清单仓库在本地的工作副本
+type Repo struct {
+	Dir    string
+	Remote string
+	Branch string
+	File   string
+}
+
+// Open 返回清单仓库的本地工作副本，首次使用时会先克隆远端仓库
+func Open(inv *config.Inventory) (*Repo, error) {
+	if inv == nil || inv.Remote == "" {
+		return nil, errors.New("no inventory remote configured")
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	r := &Repo{
+		Dir:    filepath.Join(dir, "inventory"),
+		Remote: inv.Remote,
+		Branch: inv.Branch,
+		File:   inv.File,
+	}
+	if r.Branch == "" {
+		r.Branch = defaultBranch
+	}
+	if r.File == "" {
+		r.File = defaultFile
+	}
+
+	if _, err := os.Stat(filepath.Join(r.Dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(r.Dir), 0755); err != nil {
+			return nil, err
+		}
+		if _, err := git("", "clone", "--quiet", r.Remote, r.Dir); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.git("remote", "set-url", "origin", r.Remote); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Pull 将本地工作副本重置为远端分支的最新状态
+// 工作副本完全由 kgate 管理，因此这里不需要处理 git 层面的合并冲突
+func (r *Repo) Pull() error {
+	if _, err := r.git("fetch", "--quiet", "origin"); err != nil {
+		return err
+	}
+	if _, err := r.git("rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+r.Branch); err != nil {
+		// 远端分支尚不存在（例如空仓库），从一个未提交的分支开始
+		_, err := r.git("symbolic-ref", "HEAD", "refs/heads/"+r.Branch)
+		return err
+	}
+	if _, err := r.git("checkout", "--quiet", "-B", r.Branch, "origin/"+r.Branch); err != nil {
+		return err
+	}
+	_, err := r.git("reset", "--quiet", "--hard", "origin/"+r.Branch)
+	return err
+}
+
+// Load 读取工作副本中的清单文件，文件不存在时返回空清单
+func (r *Repo) Load() (*config.Config, error) {
+	data, err := os.ReadFile(filepath.Join(r.Dir, r.File))
+	if os.IsNotExist(err) {
+		return &config.Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	team, err := config.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", r.File, err)
+	}
+	return team, nil
+}
+
+// Commit 写入清单文件并推送到远端
+func (r *Repo) Commit(team *config.Config, message string) error {
+	data, err := yaml.Marshal(&config.Config{Clusters: team.Clusters})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(r.Dir, r.File)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	if _, err := r.git("add", r.File); err != nil {
+		return err
+	}
+	if err := r.checkIdentity(); err != nil {
+		return err
+	}
+	if _, err := r.git("commit", "--quiet", "-m", message); err != nil {
+		return err
+	}
+	_, err = r.git("push", "--quiet", "origin", "HEAD:refs/heads/"+r.Branch)
+	return err
+}
+
+// checkIdentity 确认 git 配置了提交者身份，避免提交失败时只得到 git 的原始错误
+func (r *Repo) checkIdentity() error {
+	for _, key := range []string{"user.name", "user.email"} {
+		if out, err := r.git("config", key); err != nil || strings.TrimSpace(out) == "" {
+			return fmt.Errorf("git %s is not set, configure it with 'git config --global %s ...' before pushing", key, key)
+		}
+	}
+	return nil
+}
+
+func (r *Repo) git(args ...string) (string, error) {
+	return git(r.Dir, args...)
+}
+
+func git(dir string, args ...string) (string, error) {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
+
+// Merge 将团队清单中的集群和节点合并到个人配置中
+// 个人配置中已存在的条目始终保留，差异会以冲突的形式逐个报告
+func Merge(local, team *config.Config) Result {
+	var res Result
+	for _, tc := range team.Clusters {
+		// 加密的敏感信息只能用各自的主密钥解密，从不在团队之间同步
+		tc.Secrets = nil
+		lc, err := local.FindCluster(tc.Name)
+		if err != nil {
+			local.Clusters = append(local.Clusters, tc)
+			res.AddedClusters++
+			res.AddedNodes += len(tc.Nodes)
+			continue
+		}
+		res.Conflicts = append(res.Conflicts, compareBastion(tc.Name, &lc.Bastion, &tc.Bastion)...)
+		for _, tn := range tc.Nodes {
+			ln := findNode(lc, tn.Alias)
+			if ln == nil {
+				lc.Nodes = append(lc.Nodes, tn)
+				res.AddedNodes++
+				continue
+			}
+			res.Conflicts = append(res.Conflicts, compareNode(tc.Name, ln, &tn)...)
+		}
+	}
+	return res
+}
+
+// Publish 将个人配置中新增的节点写入团队清单
+// 默认只处理团队清单中已有的集群；指定 cluster 时允许发布一个新的集群
+func Publish(local, team *config.Config, cluster string) Result {
+	var res Result
+	for _, lc := range local.Clusters {
+		if cluster != "" && lc.Name != cluster {
+			continue
+		}
+		tc, err := team.FindCluster(lc.Name)
+		if err != nil {
+			if cluster == "" {
+				continue
+			}
+			team.Clusters = append(team.Clusters, shareable(lc))
+			res.AddedClusters++
+			res.AddedNodes += len(lc.Nodes)
+			continue
+		}
+		for _, ln := range lc.Nodes {
+			tn := findNode(tc, ln.Alias)
+			if tn == nil {
+				tc.Nodes = append(tc.Nodes, shareableNode(ln))
+				res.AddedNodes++
+				continue
+			}
+			res.Conflicts = append(res.Conflicts, compareNode(lc.Name, &ln, tn)...)
+		}
+	}
+	return res
+}
+
+// shareable 去掉集群中只对本机有意义的字段：加密的敏感信息只能用个人的主密钥解密，
+// 私钥路径和 ssh-agent 中的密钥指纹也因人而异
+func shareable(c config.Cluster) config.Cluster {
+	c.Secrets = nil
+	c.Bastion.IdentityFile = ""
+	c.Bastion.AgentKey = ""
+	nodes := make([]config.Node, len(c.Nodes))
+	for i, n := range c.Nodes {
+		nodes[i] = shareableNode(n)
+	}
+	c.Nodes = nodes
+	return c
+}
+
+// shareableNode 去掉节点中只反映本机 discover 状态的字段：对账得到的 stale 标记和最后在线时间，
+// 以及扫描到的服务记录，它们取决于谁在什么时候扫描过，不应该推给整个团队
+func shareableNode(n config.Node) config.Node {
+	n.Stale = false
+	n.LastSeen = nil
+	n.Forwards = nil
+	return n
+}
+
+func findNode(c *config.Cluster, alias string) *config.Node {
+	for i := range c.Nodes {
+		if c.Nodes[i].Alias == alias {
+			return &c.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func compareBastion(cluster string, local, remote *config.Bastion) []Conflict {
+	var conflicts []Conflict
+	if local.Host != remote.Host {
+		conflicts = append(conflicts, Conflict{Cluster: cluster, Field: "host", Local: local.Host, Remote: remote.Host})
+	}
+	if local.User != remote.User {
+		conflicts = append(conflicts, Conflict{Cluster: cluster, Field: "user", Local: local.User, Remote: remote.User})
+	}
+	if local.Port != remote.Port {
+		conflicts = append(conflicts, Conflict{Cluster: cluster, Field: "port", Local: fmt.Sprint(local.Port), Remote: fmt.Sprint(remote.Port)})
+	}
+	return conflicts
+}
+
+func compareNode(cluster string, local, remote *config.Node) []Conflict {
+	var conflicts []Conflict
+	if local.IP != remote.IP {
+		conflicts = append(conflicts, Conflict{Cluster: cluster, Alias: local.Alias, Field: "ip", Local: local.IP, Remote: remote.IP})
+	}
+	if local.User != remote.User {
+		conflicts = append(conflicts, Conflict{Cluster: cluster, Alias: local.Alias, Field: "user", Local: local.User, Remote: remote.User})
+	}
+	return conflicts
+}
@@ -0,0 +1,186 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitlayzer/kgate/internal/config"
+)
+
+func cluster(name, host string, nodes ...config.Node) config.Cluster {
+	return config.Cluster{Name: name, Bastion: config.Bastion{Host: host, User: "ops"}, Nodes: nodes}
+}
+
+func node(alias, ip string) config.Node {
+	return config.Node{Alias: alias, IP: ip, User: "root"}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		local     []config.Cluster
+		team      []config.Cluster
+		clusters  int
+		nodes     int
+		conflicts []string
+	}{
+		{
+			name:     "new cluster",
+			team:     []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.1"))},
+			clusters: 1,
+			nodes:    1,
+		},
+		{
+			name:  "new node in existing cluster",
+			local: []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.1"))},
+			team:  []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.1"), node("db1", "10.0.0.2"))},
+			nodes: 1,
+		},
+		{
+			name:      "node ip differs",
+			local:     []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.1"))},
+			team:      []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.9"))},
+			conflicts: []string{`prod/web1: ip differs (local: "10.0.0.1", inventory: "10.0.0.9")`},
+		},
+		{
+			name:      "bastion host differs",
+			local:     []config.Cluster{cluster("prod", "1.1.1.1")},
+			team:      []config.Cluster{cluster("prod", "2.2.2.2")},
+			conflicts: []string{`prod/bastion: host differs (local: "1.1.1.1", inventory: "2.2.2.2")`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := &config.Config{Clusters: tt.local}
+			res := Merge(local, &config.Config{Clusters: tt.team})
+			if res.AddedClusters != tt.clusters || res.AddedNodes != tt.nodes {
+				t.Errorf("added %d cluster(s) and %d node(s), want %d and %d", res.AddedClusters, res.AddedNodes, tt.clusters, tt.nodes)
+			}
+			checkConflicts(t, res.Conflicts, tt.conflicts)
+		})
+	}
+}
+
+func TestMergeKeepsLocalValues(t *testing.T) {
+	local := &config.Config{Clusters: []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.1"))}}
+	team := &config.Config{Clusters: []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.9"))}}
+	Merge(local, team)
+	if ip := local.Clusters[0].Nodes[0].IP; ip != "10.0.0.1" {
+		t.Errorf("local ip overwritten with %s", ip)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name      string
+		local     []config.Cluster
+		team      []config.Cluster
+		cluster   string
+		clusters  int
+		nodes     int
+		conflicts []string
+	}{
+		{
+			name:  "local node added",
+			local: []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.1"), node("db1", "10.0.0.2"))},
+			team:  []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.1"))},
+			nodes: 1,
+		},
+		{
+			name:  "unknown cluster skipped without --cluster",
+			local: []config.Cluster{cluster("stage", "2.2.2.2", node("s1", "10.1.0.1"))},
+		},
+		{
+			name:     "unknown cluster published with --cluster",
+			local:    []config.Cluster{cluster("stage", "2.2.2.2", node("s1", "10.1.0.1"))},
+			cluster:  "stage",
+			clusters: 1,
+			nodes:    1,
+		},
+		{
+			name:      "conflicting node",
+			local:     []config.Cluster{cluster("prod", "1.1.1.1", config.Node{Alias: "web1", IP: "10.0.0.1", User: "admin"})},
+			team:      []config.Cluster{cluster("prod", "1.1.1.1", node("web1", "10.0.0.1"))},
+			conflicts: []string{`prod/web1: user differs (local: "admin", inventory: "root")`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Publish(&config.Config{Clusters: tt.local}, &config.Config{Clusters: tt.team}, tt.cluster)
+			if res.AddedClusters != tt.clusters || res.AddedNodes != tt.nodes {
+				t.Errorf("added %d cluster(s) and %d node(s), want %d and %d", res.AddedClusters, res.AddedNodes, tt.clusters, tt.nodes)
+			}
+			checkConflicts(t, res.Conflicts, tt.conflicts)
+		})
+	}
+}
+
+func TestPublishStripsLocalFields(t *testing.T) {
+	seen := time.Unix(1700000000, 0)
+	discovered := func(alias, ip string) config.Node {
+		n := node(alias, ip)
+		n.Labels = map[string]string{"os": "ubuntu"}
+		n.Stale = true
+		n.LastSeen = &seen
+		n.Forwards = []config.Forward{{Name: "postgres", RemotePort: 5432, Service: "postgres"}}
+		return n
+	}
+	c := cluster("stage", "2.2.2.2", discovered("s1", "10.1.0.1"))
+	c.Bastion.IdentityFile = "/home/me/.ssh/id_ed25519"
+	c.Bastion.AgentKey = "SHA256:abc"
+	c.Secrets = map[string]string{"sudo-password": "ciphertext"}
+
+	tests := []struct {
+		name    string
+		local   config.Cluster
+		team    []config.Cluster
+		cluster string
+	}{
+		{name: "new cluster", local: c, cluster: "stage"},
+		{
+			name:  "new node in existing cluster",
+			local: cluster("stage", "2.2.2.2", discovered("s1", "10.1.0.1")),
+			team:  []config.Cluster{cluster("stage", "2.2.2.2")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := &config.Config{Clusters: tt.team}
+			Publish(&config.Config{Clusters: []config.Cluster{tt.local}}, team, tt.cluster)
+
+			got := team.Clusters[0]
+			if got.Bastion.IdentityFile != "" || got.Bastion.AgentKey != "" || got.Secrets != nil {
+				t.Errorf("machine-local fields published: %+v", got)
+			}
+			if got.Bastion.Host != "2.2.2.2" {
+				t.Errorf("bastion host = %q, want 2.2.2.2", got.Bastion.Host)
+			}
+			if len(got.Nodes) != 1 {
+				t.Fatalf("published %d node(s), want 1", len(got.Nodes))
+			}
+			n := got.Nodes[0]
+			if n.Stale || n.LastSeen != nil || n.Forwards != nil {
+				t.Errorf("discover state published: %+v", n)
+			}
+			if n.IP != "10.1.0.1" || n.Labels["os"] != "ubuntu" {
+				t.Errorf("published node = %+v, want ip and labels kept", n)
+			}
+			// 发布不能修改个人配置中的节点
+			if ln := tt.local.Nodes[0]; !ln.Stale || ln.LastSeen == nil || ln.Forwards == nil {
+				t.Errorf("local node modified: %+v", ln)
+			}
+		})
+	}
+}
+
+func checkConflicts(t *testing.T, got []Conflict, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d conflict(s) %v, want %v", len(got), got, want)
+	}
+	for i := range got {
+		if got[i].String() != want[i] {
+			t.Errorf("conflict %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package scan
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter 限制每秒发起的连接数，由所有扫描 worker 共享
+// 每次连接尝试（包括 SSH 标识、指纹和各服务探测的连接）都需要先取得一个配额
+type Limiter struct {
+	ticker *time.Ticker
+}
+
+// NewLimiter 返回每秒最多放行 rate 次连接的限速器，rate <= 0 时返回 nil，表示不限速
+func NewLimiter(rate int) *Limiter {
+	interval := time.Second / time.Duration(max(rate, 1))
+	if rate <= 0 || interval <= 0 {
+		return nil
+	}
+	return &Limiter{ticker: time.NewTicker(interval)}
+}
+
+// Wait 阻塞到下一个配额可用或 ctx 被取消；nil 的 Limiter 不限速
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-l.ticker.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop 释放限速器的定时器
+func (l *Limiter) Stop() {
+	if l != nil {
+		l.ticker.Stop()
+	}
+}
@@ -0,0 +1,46 @@
+package scan
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		rate int
+		min  time.Duration // 取得 5 个配额至少需要的时间
+	}{
+		{"unlimited", 0, 0},
+		{"negative", -1, 0},
+		{"100 per second", 100, 40 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.rate)
+			defer l.Stop()
+			start := time.Now()
+			for i := 0; i < 5; i++ {
+				if err := l.Wait(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if elapsed := time.Since(start); elapsed < tt.min {
+				t.Errorf("5 waits took %s, want at least %s", elapsed, tt.min)
+			}
+		})
+	}
+}
+
+func TestLimiterCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, rate := range []int{0, 1} {
+		l := NewLimiter(rate)
+		if err := l.Wait(ctx); err == nil {
+			t.Errorf("rate %d: Wait on a canceled context succeeded", rate)
+		}
+		l.Stop()
+	}
+}
@@ -0,0 +1,118 @@
+package scan
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrNotSSH 表示端口虽然开放，但对端没有发送 SSH 协议标识
+var ErrNotSSH = errors.New("not an SSH server")
+
+// Banner 是 SSH 服务端的协议标识行，如 "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1"
+type Banner struct {
+	Raw      string
+	Proto    string // 协议版本，如 2.0
+	Software string // 服务端软件及版本，如 OpenSSH_8.9p1
+	Comments string // 软件版本之后的注释，通常包含发行版信息
+}
+
+// ParseBanner 解析 SSH 协议标识行
+func ParseBanner(line string) (*Banner, error) {
+	line = strings.TrimRight(line, "\r\n")
+	rest, ok := strings.CutPrefix(line, "SSH-")
+	if !ok {
+		return nil, ErrNotSSH
+	}
+	proto, rest, ok := strings.Cut(rest, "-")
+	if !ok || (proto != "2.0" && proto != "1.99") {
+		return nil, fmt.Errorf("unsupported SSH protocol in %q", line)
+	}
+	software, comments, _ := strings.Cut(rest, " ")
+	return &Banner{Raw: line, Proto: proto, Software: software, Comments: comments}, nil
+}
+
+// OS 根据标识中的注释推测对端的操作系统，无法判断时返回空字符串
+func (b *Banner) OS() string {
+	c := strings.ToLower(b.Comments)
+	switch {
+	case strings.Contains(b.Software, "for_Windows"):
+		return "Windows"
+	case strings.Contains(c, "ubuntu"):
+		return "Ubuntu"
+	case strings.Contains(c, "raspbian"):
+		return "Raspbian"
+	case strings.Contains(c, "deb"):
+		// Debian 的包版本形如 Debian-5+deb11u1，其中 deb11 即发行版本
+		if i := strings.Index(c, "+deb"); i >= 0 {
+			ver := c[i+4:]
+			if j := strings.IndexFunc(ver, func(r rune) bool { return r < '0' || r > '9' }); j >= 0 {
+				ver = ver[:j]
+			}
+			if ver != "" {
+				return "Debian " + ver
+			}
+		}
+		return "Debian"
+	case strings.Contains(c, "freebsd"):
+		return "FreeBSD"
+	}
+	return ""
+}
+
+// String 返回用于展示的简要描述，如 "OpenSSH_8.9p1 (Ubuntu)"
+func (b *Banner) String() string {
+	if os := b.OS(); os != "" {
+		return fmt.Sprintf("%s (%s)", b.Software, os)
+	}
+	return b.Software
+}
+
+// ReadBanner 从连接中读取 SSH 协议标识
+// 按 RFC 4253，服务端可以在标识行之前发送其他文本行，这里最多跳过 20 行
+func ReadBanner(conn net.Conn, timeout time.Duration) (*Banner, error) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	r := bufio.NewReaderSize(conn, 256)
+	for i := 0; i < 20; i++ {
+		line, err := r.ReadString('\n')
+		if strings.HasPrefix(line, "SSH-") {
+			return ParseBanner(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotSSH, err)
+		}
+	}
+	return nil, ErrNotSSH
+}
+
+// errHostKey 用于在拿到主机公钥后立即中止握手，无需进行用户认证
+var errHostKey = errors.New("host key received")
+
+// HostKey 在连接上完成 SSH 密钥交换并返回服务端的主机公钥
+// conn 必须是尚未读取任何数据的新连接，函数返回时会关闭它
+func HostKey(conn net.Conn, addr string, timeout time.Duration) (ssh.PublicKey, error) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var key ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User: "kgate",
+		HostKeyCallback: func(_ string, _ net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errHostKey
+		},
+		Timeout: timeout,
+	}
+	_, _, _, err := ssh.NewClientConn(conn, addr, config)
+	if key != nil {
+		return key, nil
+	}
+	return nil, err
+}
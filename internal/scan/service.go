@@ -0,0 +1,183 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Service 是在主机某个端口上识别出的服务
+type Service struct {
+	Port   int
+	Name   string // ssh、postgres、redis、mysql、http、https、kubernetes 等，无法识别时为 unknown
+	Detail string // 版本等附加信息
+}
+
+func (s Service) String() string {
+	if s.Detail != "" {
+		return fmt.Sprintf("%d/%s (%s)", s.Port, s.Name, s.Detail)
+	}
+	return fmt.Sprintf("%d/%s", s.Port, s.Name)
+}
+
+// probe 在一个新连接上发送探测数据并判断服务类型，无法识别时返回 nil
+type probe func(conn net.Conn, timeout time.Duration) *Service
+
+// Identify 识别 port 上运行的服务，dial 每次调用都需要返回一个到该端口的新连接
+// 先等待服务端主动发送的问候（SSH、MySQL、SMTP 等），没有问候时再依次尝试各种探测，
+// 每种探测使用单独的连接，端口无法连接时返回连接错误
+func Identify(dial func() (net.Conn, error), port int, timeout time.Duration) (*Service, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	svc := greeting(conn, timeout)
+	conn.Close()
+	if svc != nil {
+		svc.Port = port
+		return svc, nil
+	}
+
+	for _, p := range probesFor(port) {
+		conn, err := dial()
+		if err != nil {
+			break
+		}
+		svc := p(conn, timeout)
+		conn.Close()
+		if svc != nil {
+			svc.Port = port
+			return svc, nil
+		}
+	}
+	return &Service{Port: port, Name: "unknown"}, nil
+}
+
+// probesFor 按端口的常见用途调整探测顺序，减少需要建立的连接数
+func probesFor(port int) []probe {
+	switch port {
+	case 5432:
+		return []probe{probePostgres, probeRedis, probeHTTP, probeTLS}
+	case 6379:
+		return []probe{probeRedis, probePostgres, probeHTTP, probeTLS}
+	case 443, 2379, 6443, 8443, 10250:
+		return []probe{probeTLS, probeHTTP, probeRedis, probePostgres}
+	}
+	return []probe{probeHTTP, probeTLS, probeRedis, probePostgres}
+}
+
+// greeting 读取服务端主动发送的数据
+func greeting(conn net.Conn, timeout time.Duration) *Service {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 512)
+	n, _ := conn.Read(buf)
+	if n == 0 {
+		return nil
+	}
+	data := buf[:n]
+
+	switch {
+	case bytes.HasPrefix(data, []byte("SSH-")):
+		line, _, _ := strings.Cut(string(data), "\n")
+		if b, err := ParseBanner(line); err == nil {
+			return &Service{Name: "ssh", Detail: b.String()}
+		}
+		return &Service{Name: "ssh"}
+	case n > 5 && data[4] == 0x0a:
+		// MySQL 握手包：3 字节长度 + 1 字节序号，随后是协议版本 10 和以 \0 结尾的服务端版本
+		version, _, _ := bytes.Cut(data[5:], []byte{0})
+		return &Service{Name: "mysql", Detail: string(version)}
+	case bytes.HasPrefix(data, []byte("220")):
+		line, _, _ := strings.Cut(string(data), "\n")
+		line = strings.TrimSpace(strings.TrimPrefix(line, "220"))
+		if strings.Contains(strings.ToLower(line), "ftp") {
+			return &Service{Name: "ftp", Detail: line}
+		}
+		return &Service{Name: "smtp", Detail: line}
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	return &Service{Name: "unknown", Detail: strings.TrimSpace(line)}
+}
+
+func probeRedis(conn net.Conn, timeout time.Duration) *Service {
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		return nil
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(line, "+PONG"):
+		return &Service{Name: "redis"}
+	case strings.HasPrefix(line, "-NOAUTH"), strings.HasPrefix(line, "-ERR"), strings.HasPrefix(line, "-DENIED"):
+		return &Service{Name: "redis", Detail: "auth required"}
+	}
+	return nil
+}
+
+// probePostgres 发送 SSLRequest，PostgreSQL 会以单个字节 S 或 N 应答
+func probePostgres(conn net.Conn, timeout time.Duration) *Service {
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}); err != nil {
+		return nil
+	}
+	reply := make([]byte, 2)
+	n, _ := io.ReadAtLeast(conn, reply, 1)
+	if n != 1 {
+		return nil
+	}
+	switch reply[0] {
+	case 'S':
+		return &Service{Name: "postgres", Detail: "ssl"}
+	case 'N':
+		return &Service{Name: "postgres"}
+	}
+	return nil
+}
+
+func probeHTTP(conn net.Conn, timeout time.Duration) *Service {
+	conn.SetDeadline(time.Now().Add(timeout))
+	resp, err := httpGet(conn, "/")
+	if err != nil {
+		return nil
+	}
+	return &Service{Name: "http", Detail: resp.Header.Get("Server")}
+}
+
+// probeTLS 完成 TLS 握手后请求 /version，能返回 gitVersion 的即为 Kubernetes API
+func probeTLS(conn net.Conn, timeout time.Duration) *Service {
+	conn.SetDeadline(time.Now().Add(timeout))
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true}) // 只用于识别服务，不传输任何敏感数据
+	if err := tlsConn.Handshake(); err != nil {
+		return nil
+	}
+	resp, err := httpGet(tlsConn, "/version")
+	if err != nil {
+		return &Service{Name: "tls"}
+	}
+	defer resp.Body.Close()
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&version) == nil && version.GitVersion != "" {
+		return &Service{Name: "kubernetes", Detail: version.GitVersion}
+	}
+	return &Service{Name: "https", Detail: resp.Header.Get("Server")}
+}
+
+func httpGet(conn net.Conn, path string) (*http.Response, error) {
+	req := fmt.Sprintf("GET %s HTTP/1.0\r\nUser-Agent: kgate\r\n\r\n", path)
+	if _, err := io.WriteString(conn, req); err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(conn), nil)
+}
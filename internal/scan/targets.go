@@ -0,0 +1,254 @@
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"iter"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Range 是一个闭区间的地址范围
+type Range struct {
+	From, To netip.Addr
+}
+
+// Targets 描述要扫描的地址集合：若干包含范围减去若干排除范围
+type Targets struct {
+	include []Range
+	exclude []Range
+}
+
+// NewTargets 解析扫描目标
+// ranges 和 excludes 中的每一项可以是 CIDR、单个地址或 a-b 形式的地址区间，
+// files 中的每个文件每行一项，支持 # 注释
+func NewTargets(ranges, excludes, files []string) (*Targets, error) {
+	var include, exclude []Range
+	for _, s := range ranges {
+		r, err := ParseRange(s)
+		if err != nil {
+			return nil, err
+		}
+		include = append(include, r)
+	}
+	for _, path := range files {
+		rs, err := readRanges(path)
+		if err != nil {
+			return nil, err
+		}
+		include = append(include, rs...)
+	}
+	for _, s := range excludes {
+		r, err := parseRange(s, false)
+		if err != nil {
+			return nil, err
+		}
+		exclude = append(exclude, r)
+	}
+	if len(include) == 0 {
+		return nil, fmt.Errorf("no scan targets given")
+	}
+	return &Targets{include: merge(include), exclude: merge(exclude)}, nil
+}
+
+// ParseRange 解析 CIDR、单个地址或地址区间
+// IPv4 的 CIDR 会去掉网络地址和广播地址；区间的结束地址可以只写最后一段，如 10.0.0.10-80
+func ParseRange(s string) (Range, error) {
+	return parseRange(s, true)
+}
+
+// parseRange 解析地址范围，hostsOnly 为 false 时 IPv4 CIDR 保留网络地址和广播地址（用于排除范围）
+func parseRange(s string, hostsOnly bool) (Range, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return Range{}, err
+		}
+		prefix = prefix.Masked()
+		r := Range{From: prefix.Addr(), To: lastAddr(prefix)}
+		if hostsOnly && r.From.Is4() && prefix.Bits() < 31 {
+			r.From, r.To = r.From.Next(), r.To.Prev()
+		}
+		return r, nil
+	}
+
+	if from, to, ok := strings.Cut(s, "-"); ok {
+		start, err := netip.ParseAddr(strings.TrimSpace(from))
+		if err != nil {
+			return Range{}, err
+		}
+		to = strings.TrimSpace(to)
+		if start.Is4() && !strings.Contains(to, ".") {
+			octets := strings.Split(start.String(), ".")
+			to = strings.Join(append(octets[:3], to), ".")
+		}
+		end, err := netip.ParseAddr(to)
+		if err != nil {
+			return Range{}, err
+		}
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return Range{}, fmt.Errorf("invalid address range %q", s)
+		}
+		return Range{From: start, To: end}, nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return Range{}, err
+	}
+	return Range{From: addr, To: addr}, nil
+}
+
+// All 逐个产出需要扫描的地址，不会预先在内存中展开整个范围
+func (t *Targets) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for _, r := range t.include {
+			for addr := r.From; ; addr = addr.Next() {
+				if !t.excluded(addr) && !yield(addr) {
+					return
+				}
+				if addr == r.To {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Count 返回需要扫描的地址数量（已扣除排除范围），超出 uint64 时返回最大值
+func (t *Targets) Count() uint64 {
+	total := new(big.Int)
+	for _, r := range t.include {
+		total.Add(total, r.size())
+		// include 和 exclude 都已合并，彼此不重叠，因此逐个扣除交集即可
+		for _, x := range t.exclude {
+			if r.From.Is4() != x.From.Is4() || x.To.Less(r.From) || r.To.Less(x.From) {
+				continue
+			}
+			overlap := Range{From: maxAddr(r.From, x.From), To: minAddr(r.To, x.To)}
+			total.Sub(total, overlap.size())
+		}
+	}
+	if !total.IsUint64() {
+		return math.MaxUint64
+	}
+	return total.Uint64()
+}
+
+// String 返回目标的简要描述
+func (t *Targets) String() string {
+	var parts []string
+	for _, r := range t.include {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (r Range) String() string {
+	if r.From == r.To {
+		return r.From.String()
+	}
+	return r.From.String() + "-" + r.To.String()
+}
+
+// Contains 判断地址是否在范围内
+func (r Range) Contains(addr netip.Addr) bool {
+	return r.From.Compare(addr) <= 0 && addr.Compare(r.To) <= 0
+}
+
+func (r Range) size() *big.Int {
+	from := new(big.Int).SetBytes(r.From.AsSlice())
+	to := new(big.Int).SetBytes(r.To.AsSlice())
+	return to.Sub(to, from).Add(to, big.NewInt(1))
+}
+
+// Contains 判断地址是否属于扫描目标
+func (t *Targets) Contains(addr netip.Addr) bool {
+	for _, r := range t.include {
+		if r.Contains(addr) {
+			return !t.excluded(addr)
+		}
+	}
+	return false
+}
+
+func (t *Targets) excluded(addr netip.Addr) bool {
+	for _, r := range t.exclude {
+		if r.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// merge 排序并合并重叠或相邻的范围，这样重复的目标只会被扫描一次
+func merge(ranges []Range) []Range {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].From.Less(ranges[j].From) })
+	merged := []Range{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		next := last.To.Next()
+		if r.From.Is4() == last.To.Is4() && (r.From.Compare(last.To) <= 0 || (next.IsValid() && r.From == next)) {
+			if last.To.Less(r.To) {
+				last.To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func maxAddr(a, b netip.Addr) netip.Addr {
+	if a.Less(b) {
+		return b
+	}
+	return a
+}
+
+func minAddr(a, b netip.Addr) netip.Addr {
+	if a.Less(b) {
+		return a
+	}
+	return b
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+func readRanges(path string) ([]Range, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ranges []Range
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		r, err := ParseRange(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, scanner.Err()
+}
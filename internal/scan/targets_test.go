@@ -0,0 +1,181 @@
+package scan
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "10.0.0.5", want: "10.0.0.5"},
+		{in: " 10.0.0.5 ", want: "10.0.0.5"},
+		{in: "192.168.1.0/24", want: "192.168.1.1-192.168.1.254"},
+		{in: "192.168.1.77/24", want: "192.168.1.1-192.168.1.254"},
+		{in: "10.0.0.0/31", want: "10.0.0.0-10.0.0.1"},
+		{in: "10.0.0.9/32", want: "10.0.0.9"},
+		{in: "10.0.0.10-10.0.0.80", want: "10.0.0.10-10.0.0.80"},
+		{in: "10.0.0.10-80", want: "10.0.0.10-10.0.0.80"},
+		{in: "10.0.0.10 - 80", want: "10.0.0.10-10.0.0.80"},
+		{in: "fd00::/120", want: "fd00::-fd00::ff"},
+		{in: "fd00::1-fd00::5", want: "fd00::1-fd00::5"},
+		{in: "fd00::1", want: "fd00::1"},
+		{in: "10.0.0.80-10", wantErr: true},
+		{in: "10.0.0.1-fd00::1", wantErr: true},
+		{in: "fd00::1-5", wantErr: true},
+		{in: "10.0.0.0/33", wantErr: true},
+		{in: "10.0.0.300", wantErr: true},
+		{in: "db1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			r, err := ParseRange(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRange(%q) = %s, want error", tt.in, r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.String() != tt.want {
+				t.Errorf("ParseRange(%q) = %s, want %s", tt.in, r, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   []string
+		excludes []string
+		want     []string
+	}{
+		{
+			name:   "range",
+			ranges: []string{"10.0.0.1-3"},
+			want:   []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name:   "overlapping and adjacent ranges merged",
+			ranges: []string{"10.0.0.3-5", "10.0.0.1-3", "10.0.0.6"},
+			want:   []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"},
+		},
+		{
+			name:     "exclude single address",
+			ranges:   []string{"10.0.0.0/30"},
+			excludes: []string{"10.0.0.2"},
+			want:     []string{"10.0.0.1"},
+		},
+		{
+			// 排除范围中的 CIDR 包含网络地址和广播地址
+			name:     "exclude cidr keeps network and broadcast",
+			ranges:   []string{"10.0.0.0-10.0.0.9"},
+			excludes: []string{"10.0.0.0/30"},
+			want:     []string{"10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7", "10.0.0.8", "10.0.0.9"},
+		},
+		{
+			name:     "exclude everything",
+			ranges:   []string{"10.0.0.1-2"},
+			excludes: []string{"10.0.0.0/24"},
+		},
+		{
+			name:   "ipv6",
+			ranges: []string{"fd00::/126"},
+			want:   []string{"fd00::", "fd00::1", "fd00::2", "fd00::3"},
+		},
+		{
+			name:     "ipv6 exclude",
+			ranges:   []string{"fd00::1-fd00::4"},
+			excludes: []string{"fd00::2-fd00::3"},
+			want:     []string{"fd00::1", "fd00::4"},
+		},
+		{
+			name:     "mixed families",
+			ranges:   []string{"fd00::1", "10.0.0.1", "10.0.0.2"},
+			excludes: []string{"fd00::2", "10.0.0.2"},
+			want:     []string{"10.0.0.1", "fd00::1"},
+		},
+		{
+			name:   "last ipv4 address",
+			ranges: []string{"255.255.255.254-255"},
+			want:   []string{"255.255.255.254", "255.255.255.255"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := NewTargets(tt.ranges, tt.excludes, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for addr := range targets.All() {
+				got = append(got, addr.String())
+				if !targets.Contains(addr) {
+					t.Errorf("Contains(%s) = false for a yielded address", addr)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("All() = %v, want %v", got, tt.want)
+			}
+			if n := targets.Count(); n != uint64(len(tt.want)) {
+				t.Errorf("Count() = %d, want %d", n, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestTargetsCountLarge(t *testing.T) {
+	tests := []struct {
+		ranges   []string
+		excludes []string
+		want     uint64
+	}{
+		{[]string{"10.0.0.0/8"}, nil, 1<<24 - 2},
+		{[]string{"10.0.0.0/16"}, []string{"10.0.1.0/24"}, 1<<16 - 2 - 256},
+		{[]string{"fd00::/65"}, nil, 1 << 63},
+		{[]string{"fd00::/64"}, nil, math.MaxUint64}, // 超出 uint64 时返回最大值
+	}
+	for _, tt := range tests {
+		targets, err := NewTargets(tt.ranges, tt.excludes, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := targets.Count(); n != tt.want {
+			t.Errorf("Count(%v - %v) = %d, want %d", tt.ranges, tt.excludes, n, tt.want)
+		}
+	}
+}
+
+func TestNewTargetsFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets")
+	content := "# office\n10.0.0.1\n\n10.0.0.5-6 # lab\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := NewTargets(nil, nil, []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := targets.String(); got != "10.0.0.1, 10.0.0.5-10.0.0.6" {
+		t.Errorf("targets = %s", got)
+	}
+
+	if err := os.WriteFile(path, []byte("10.0.0.1\nbogus\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTargets(nil, nil, []string{path}); err == nil {
+		t.Error("NewTargets accepted an invalid line")
+	}
+	if _, err := NewTargets(nil, nil, nil); err == nil {
+		t.Error("NewTargets without targets succeeded")
+	}
+}
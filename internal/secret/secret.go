@@ -0,0 +1,121 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+)
+
+const (
+	// secret 所属的集群和名称作为 AES-GCM 的附加数据，密文不能在条目之间调换
+	prefix     = "enc:v2:"
+	saltSize   = 16
+	keySize    = 32
+	iterations = 600000
+)
+
+// ErrDecrypt 表示密文无法用给定的主密钥解密（通常是主口令错误）
+var ErrDecrypt = errors.New("unable to decrypt secret: wrong master passphrase or key file")
+
+// IsEncrypted 判断一个配置值是否为 kgate 加密格式
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt 使用主密钥材料（口令或密钥文件内容）加密明文，context 标识 secret 所属的条目（例如 集群/名称），
+// 解密时必须提供相同的 context。每个值使用独立的盐和随机数，格式为 enc:v2:base64(salt|nonce|ciphertext)
+func Encrypt(master []byte, plaintext, context string) (string, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(master, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	out := append(salt, nonce...)
+	out = gcm.Seal(out, nonce, []byte(plaintext), []byte(context))
+	return prefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Decrypt 解密由 Encrypt 生成的值，context 与加密时不一致时解密失败
+func Decrypt(master []byte, value, context string) (string, error) {
+	value, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return "", errors.New("value is not an encrypted secret")
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < saltSize {
+		return "", ErrDecrypt
+	}
+	salt, data := data[:saltSize], data[saltSize:]
+	gcm, err := newGCM(master, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", ErrDecrypt
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(context))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+// NewKey 生成一份随机的主密钥文件内容
+func NewKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key) + "\n", nil
+}
+
+// derivedKeys 缓存本进程中已经派生过的密钥，批量连接时不必为每条 ssh 命令重新计算 PBKDF2
+var (
+	derivedMu   sync.Mutex
+	derivedKeys = map[[sha256.Size]byte][]byte{}
+)
+
+func deriveKey(master, salt []byte) ([]byte, error) {
+	id := sha256.Sum256(append(append([]byte{}, salt...), master...))
+	derivedMu.Lock()
+	defer derivedMu.Unlock()
+	if key, ok := derivedKeys[id]; ok {
+		return key, nil
+	}
+	key, err := pbkdf2.Key(sha256.New, string(master), salt, iterations, keySize)
+	if err != nil {
+		return nil, err
+	}
+	derivedKeys[id] = key
+	return key, nil
+}
+
+func newGCM(master, salt []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(master, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,90 @@
+package secret
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	master := []byte("correct horse battery staple")
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"empty", ""},
+		{"ascii", "s3cret pass"},
+		{"unicode", "口令 with spaces\tand tabs"},
+		{"newline", "line1\nline2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := Encrypt(master, tt.plaintext, "prod/sudo-password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsEncrypted(enc) {
+				t.Fatalf("IsEncrypted(%q) = false", enc)
+			}
+			got, err := Decrypt(master, enc, "prod/sudo-password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.plaintext {
+				t.Errorf("Decrypt = %q, want %q", got, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	master := []byte("master")
+	enc, err := Encrypt(master, "value", "prod/bastion-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		master  string
+		value   string
+		context string
+	}{
+		{"wrong master", "other", enc, "prod/bastion-passphrase"},
+		{"other cluster", "master", enc, "stage/bastion-passphrase"},
+		{"other name", "master", enc, "prod/sudo-password"},
+		{"truncated", "master", prefix + "AAAA", "prod/bastion-passphrase"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt([]byte(tt.master), tt.value, tt.context); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("Decrypt error = %v, want ErrDecrypt", err)
+			}
+		})
+	}
+	if _, err := Decrypt(master, "plain", ""); err == nil {
+		t.Error("Decrypt of an unencrypted value succeeded")
+	}
+}
+
+// 不绑定附加数据的 enc:v1 格式从未发布，不能用来绕过附加数据的检查
+func TestRejectV1(t *testing.T) {
+	master := []byte("master")
+	salt := make([]byte, saltSize)
+	rand.Read(salt)
+	gcm, err := newGCM(master, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	out := gcm.Seal(append(salt, nonce...), nonce, []byte("moved"), nil)
+	value := "enc:v1:" + base64.StdEncoding.EncodeToString(out)
+
+	if IsEncrypted(value) {
+		t.Errorf("IsEncrypted(%q) = true", value)
+	}
+	if got, err := Decrypt(master, value, "prod/sudo-password"); err == nil {
+		t.Errorf("Decrypt of an enc:v1 value = %q, want error", got)
+	}
+}
@@ -0,0 +1,121 @@
+package sshkey
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// PublicKey 是一行 authorized_keys 格式的公钥
+type PublicKey struct {
+	Type    string
+	Blob    string // base64 编码的公钥数据
+	Comment string
+}
+
+// Parse 解析 "type base64 [comment]" 格式的公钥
+func Parse(line string) (*PublicKey, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid public key %q", line)
+	}
+	if _, err := base64.StdEncoding.DecodeString(fields[1]); err != nil {
+		return nil, fmt.Errorf("invalid public key data: %w", err)
+	}
+	return &PublicKey{
+		Type:    fields[0],
+		Blob:    fields[1],
+		Comment: strings.Join(fields[2:], " "),
+	}, nil
+}
+
+// ParseAuthorizedKey 解析 authorized_keys 中的一行，返回公钥和行首的选项（如 from="..."）
+func ParseAuthorizedKey(line string) (key *PublicKey, options string, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, "", errors.New("not a key line")
+	}
+	if key, err := Parse(line); err == nil && isKeyType(key.Type) {
+		return key, "", nil
+	}
+	fields := strings.Fields(line)
+	for i := 1; i < len(fields)-1; i++ {
+		if !isKeyType(fields[i]) {
+			continue
+		}
+		if key, err := Parse(strings.Join(fields[i:], " ")); err == nil {
+			return key, strings.Join(fields[:i], " "), nil
+		}
+	}
+	return nil, "", fmt.Errorf("invalid authorized_keys line %q", line)
+}
+
+func isKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-") || strings.HasPrefix(s, "sk-")
+}
+
+// Fingerprint 返回与 ssh-keygen -l 相同格式的 SHA256 指纹
+func (k *PublicKey) Fingerprint() string {
+	data, _ := base64.StdEncoding.DecodeString(k.Blob)
+	sum := sha256.Sum256(data)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// String 返回 authorized_keys 格式的公钥
+func (k *PublicKey) String() string {
+	if k.Comment == "" {
+		return k.Type + " " + k.Blob
+	}
+	return k.Type + " " + k.Blob + " " + k.Comment
+}
+
+// AgentKeys 返回当前 ssh-agent (SSH_AUTH_SOCK) 中加载的公钥
+func AgentKeys() ([]*PublicKey, error) {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return nil, errors.New("no ssh-agent available: SSH_AUTH_SOCK is not set")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("ssh-add", "-L")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		// 退出码 1 表示 agent 中没有任何密钥
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ssh-add -L: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	var keys []*PublicKey
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		key, err := Parse(scanner.Text())
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, scanner.Err()
+}
+
+// FindAgentKey 在 ssh-agent 中查找指纹匹配的密钥
+func FindAgentKey(fingerprint string) (*PublicKey, error) {
+	keys, err := AgentKeys()
+	if err != nil {
+		return nil, err
+	}
+	want := strings.TrimPrefix(fingerprint, "SHA256:")
+	for _, key := range keys {
+		if strings.TrimPrefix(key.Fingerprint(), "SHA256:") == want {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no key with fingerprint %s in ssh-agent", fingerprint)
+}
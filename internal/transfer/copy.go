@@ -0,0 +1,79 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// Copy 将 src 节点上的文件或目录复制为 dst 节点上的路径 to，数据经由本机中转，不落盘
+// 目录会递归复制，并保留权限、修改时间和符号链接
+func Copy(src *Client, from string, dst *Client, to string, opts Options) error {
+	info, err := src.Lstat(from)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := src.ReadLink(from)
+		if err != nil {
+			return err
+		}
+		dst.Remove(to)
+		return dst.Symlink(target, to)
+	case info.IsDir():
+		if err := dst.MkdirAll(to); err != nil {
+			return fmt.Errorf("creating %s: %w", to, err)
+		}
+		entries, err := src.ReadDir(from)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := Copy(src, path.Join(from, entry.Name()), dst, path.Join(to, entry.Name()), opts); err != nil {
+				return err
+			}
+		}
+		dst.Chmod(to, info.Mode().Perm())
+		return dst.Chtimes(to, info.ModTime(), info.ModTime())
+	case info.Mode().IsRegular():
+		return copyFile(src, from, dst, to, info, opts)
+	}
+	return nil
+}
+
+func copyFile(src *Client, from string, dst *Client, to string, info fs.FileInfo, opts Options) error {
+	in, err := src.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	part := to + PartSuffix
+	out, err := dst.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", part, err)
+	}
+	h, _ := newHash(opts, nil)
+	_, err = in.WriteTo(&progressWriter{w: io.MultiWriter(out, h), opts: opts})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("copying %s: %w", from, err)
+	}
+
+	if err := dst.Chmod(part, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := dst.rename(part, to); err != nil {
+		return err
+	}
+	if err := dst.Chtimes(to, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	h.done(opts, from, to)
+	return nil
+}
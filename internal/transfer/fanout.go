@@ -0,0 +1,206 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+// Destination 是多节点上传中的一个目标节点及其上的目标路径
+type Destination struct {
+	Client *Client
+	Path   string
+	OnFile func(src, dst, sum string) // 可选，含义同 Options.OnFile，只针对这个节点
+}
+
+// UploadMany 将本地文件或目录同时上传到多个节点
+// 每个本地文件只读取一次，数据分发给所有节点并行写入；某个节点失败不影响其他节点。
+// 每块数据写给所有节点之后才读取下一块，因此整体速度取决于最慢的节点，一个慢节点会拖慢所有节点的上传。
+// 返回值与 dests 一一对应，nil 表示该节点上传成功。opts 中只使用 Progress 和 Limiter，Progress 按本地读取的字节数报告；
+// 不支持续传，总是从头写入临时文件
+func UploadMany(dests []Destination, local string, opts Options) []error {
+	errs := make([]error, len(dests))
+	uploadMany(dests, errs, local, opts)
+	return errs
+}
+
+func uploadMany(dests []Destination, errs []error, local string, opts Options) {
+	info, err := os.Lstat(local)
+	if err != nil {
+		failAll(errs, err)
+		return
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(local)
+		if err != nil {
+			failAll(errs, err)
+			return
+		}
+		forEach(dests, errs, func(d Destination) error {
+			d.Client.Remove(d.Path)
+			return d.Client.Symlink(target, d.Path)
+		})
+	case info.IsDir():
+		forEach(dests, errs, func(d Destination) error {
+			if err := d.Client.MkdirAll(d.Path); err != nil {
+				return fmt.Errorf("creating %s: %w", d.Path, err)
+			}
+			return nil
+		})
+		entries, err := os.ReadDir(local)
+		if err != nil {
+			failAll(errs, err)
+			return
+		}
+		for _, entry := range entries {
+			children := make([]Destination, len(dests))
+			for i, d := range dests {
+				children[i] = d
+				children[i].Path = path.Join(d.Path, entry.Name())
+			}
+			uploadMany(children, errs, filepath.Join(local, entry.Name()), opts)
+		}
+		forEach(dests, errs, func(d Destination) error {
+			d.Client.Chmod(d.Path, info.Mode().Perm())
+			return d.Client.Chtimes(d.Path, info.ModTime(), info.ModTime())
+		})
+	case info.Mode().IsRegular():
+		uploadFileMany(dests, errs, local, info, opts)
+	}
+}
+
+// uploadFileMany 读取一次本地文件，经由管道分发给每个节点的写入协程
+// 写入失败的节点会关闭自己的管道，分发时随即跳过它
+func uploadFileMany(dests []Destination, errs []error, local string, info fs.FileInfo, opts Options) {
+	src, err := os.Open(local)
+	if err != nil {
+		failAll(errs, err)
+		return
+	}
+	defer src.Close()
+
+	pipes := make([]*io.PipeWriter, len(dests))
+	files := make([]*sftp.File, len(dests))
+	var wg sync.WaitGroup
+	for i, d := range dests {
+		if errs[i] != nil {
+			continue
+		}
+		part := d.Path + PartSuffix
+		dst, err := d.Client.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			errs[i] = fmt.Errorf("creating %s: %w", part, err)
+			continue
+		}
+		pr, pw := io.Pipe()
+		pipes[i], files[i] = pw, dst
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := dst.ReadFromWithConcurrency(pr, 0); err != nil {
+				errs[i] = fmt.Errorf("uploading %s: %w", local, err)
+				pr.CloseWithError(err)
+			}
+		}(i)
+	}
+
+	// 只要有一个节点需要校验就计算哈希，所有节点收到的数据相同
+	var hashOpts Options
+	for _, d := range dests {
+		if d.OnFile != nil {
+			hashOpts.OnFile = d.OnFile
+		}
+	}
+	h, _ := newHash(hashOpts, nil)
+	buf := make([]byte, 256<<10)
+	for {
+		n, err := src.Read(buf)
+		h.Write(buf[:n])
+		if n > 0 {
+			live := 0
+			for i, pw := range pipes {
+				if pw == nil {
+					continue
+				}
+				if _, err := pw.Write(buf[:n]); err != nil {
+					pw.Close()
+					pipes[i] = nil
+					continue
+				}
+				live++
+			}
+			// 限速针对发出的总数据量，每个节点都会收到一份
+			opts.Limiter.Wait(n * live)
+			report(opts, int64(n))
+			if live == 0 {
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 读取错误经由管道传给写入协程，由它们记录到 errs 中
+			for _, pw := range pipes {
+				if pw != nil {
+					pw.CloseWithError(err)
+				}
+			}
+			break
+		}
+	}
+	for _, pw := range pipes {
+		if pw != nil {
+			pw.Close()
+		}
+	}
+	wg.Wait()
+
+	for i, d := range dests {
+		if files[i] == nil {
+			continue
+		}
+		if err := files[i].Close(); err != nil && errs[i] == nil {
+			errs[i] = err
+		}
+		if errs[i] != nil {
+			continue
+		}
+		part := d.Path + PartSuffix
+		if err := d.Client.Chmod(part, info.Mode().Perm()); err != nil {
+			errs[i] = err
+			continue
+		}
+		if err := d.Client.rename(part, d.Path); err != nil {
+			errs[i] = err
+			continue
+		}
+		if errs[i] = d.Client.Chtimes(d.Path, info.ModTime(), info.ModTime()); errs[i] == nil {
+			h.done(Options{OnFile: d.OnFile}, local, d.Path)
+		}
+	}
+}
+
+// forEach 在每个尚未失败的节点上执行 fn，并记录失败
+func forEach(dests []Destination, errs []error, fn func(Destination) error) {
+	for i, d := range dests {
+		if errs[i] == nil {
+			errs[i] = fn(d)
+		}
+	}
+}
+
+func failAll(errs []error, err error) {
+	for i := range errs {
+		if errs[i] == nil {
+			errs[i] = err
+		}
+	}
+}
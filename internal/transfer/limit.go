@@ -0,0 +1,93 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter 把经过它的数据总速率限制在每秒 rate 字节以内，可以被多个并行的传输共享
+// nil 的 Limiter 表示不限速
+type Limiter struct {
+	rate float64
+	mu   sync.Mutex
+	next time.Time // 已放行的数据按限速应当传完的时刻
+}
+
+// NewLimiter 创建每秒 rate 字节的限速器，rate <= 0 时返回 nil（不限速）
+func NewLimiter(rate int64) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &Limiter{rate: float64(rate)}
+}
+
+// Wait 为 n 字节的数据等待足够的时间，使总速率不超过限制
+func (l *Limiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// Reader 返回按限速读取 r 的 Reader
+func (l *Limiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{r: r, l: l}
+}
+
+type limitedReader struct {
+	r io.Reader
+	l *Limiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	// 每次最多读取一秒的数据量，避免大块读取之后长时间停顿
+	if chunk := int(r.l.rate); len(p) > chunk && chunk > 0 {
+		p = p[:chunk]
+	}
+	n, err := r.r.Read(p)
+	r.l.Wait(n)
+	return n, err
+}
+
+// ParseRate 解析 10M、512K、1.5G 这样的速率（每秒字节数），单位按 1024 进位，可以带 B 或 /s 后缀
+func ParseRate(s string) (int64, error) {
+	v := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S")
+	v = strings.TrimSuffix(v, "IB")
+	v = strings.TrimSuffix(v, "B")
+	unit := int64(1)
+	if v != "" {
+		switch v[len(v)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			v = v[:len(v)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	// ParseFloat 也接受 Inf、NaN 和十六进制浮点数，这些都不是有效的速率
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) || n*float64(unit) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid rate '%s' (expected e.g. 10M, 512K or 1G)", s)
+	}
+	return int64(n * float64(unit)), nil
+}
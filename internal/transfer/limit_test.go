@@ -0,0 +1,49 @@
+package transfer
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "1024", want: 1024},
+		{in: "512K", want: 512 << 10},
+		{in: "10M", want: 10 << 20},
+		{in: "1G", want: 1 << 30},
+		{in: "10m", want: 10 << 20},
+		{in: "1.5M", want: 3 << 19},
+		{in: " 10M ", want: 10 << 20},
+		{in: "10MB", want: 10 << 20},
+		{in: "10MiB", want: 10 << 20},
+		{in: "10MB/s", want: 10 << 20},
+		{in: "100B", want: 100},
+		{in: "", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "-1K", wantErr: true},
+		{in: "10T", wantErr: true},
+		{in: "fast", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "1e30G", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRate(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRate(%q) = %d, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRate(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
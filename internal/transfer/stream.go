@@ -0,0 +1,140 @@
+package transfer
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Compression 是 tar 流传输使用的压缩方式
+type Compression string
+
+const (
+	CompressNone Compression = "none"
+	CompressGzip Compression = "gzip"
+	CompressZstd Compression = "zstd" // 需要本地和节点上都安装 zstd 命令
+)
+
+// ParseCompression 解析 --compress 的取值，空字符串视为 none
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(s); c {
+	case "", CompressNone:
+		return CompressNone, nil
+	case CompressGzip, CompressZstd:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown compression '%s' (expected gzip, zstd or none)", s)
+}
+
+// RemoteCommand 返回在节点上压缩（decompress 为 false）或解压 stdin 的 shell 命令，不压缩时返回空字符串
+func (c Compression) RemoteCommand(decompress bool) string {
+	switch {
+	case c == CompressGzip && decompress:
+		return "gzip -dc"
+	case c == CompressGzip:
+		return "gzip -c"
+	case c == CompressZstd && decompress:
+		return "zstd -q -dc"
+	case c == CompressZstd:
+		return "zstd -q -c"
+	}
+	return ""
+}
+
+// CompressStream 返回从 r 读取、经过压缩和限速之后的数据流，用于把本地 tar 输出发送到节点
+// 压缩或读取 r 时的错误会在读取返回的数据流时报告
+func CompressStream(r io.Reader, c Compression, limit *Limiter) io.Reader {
+	if c == CompressNone || c == "" {
+		return limit.Reader(r)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := c.writer(pw)
+		if err == nil {
+			_, err = io.Copy(w, r)
+			if closeErr := w.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return limit.Reader(pr)
+}
+
+// DecompressStream 返回对 r 限速读取并解压后的数据流，用于把节点发来的 tar 包交给本地 tar
+func DecompressStream(r io.Reader, c Compression, limit *Limiter) io.Reader {
+	r = limit.Reader(r)
+	if c == CompressNone || c == "" {
+		return r
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		// gzip.NewReader 会立即读取头部，放在协程中以免阻塞调用方
+		dec, err := c.reader(r)
+		if err == nil {
+			_, err = io.Copy(pw, dec)
+			if closeErr := dec.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+func (c Compression) writer(w io.Writer) (io.WriteCloser, error) {
+	if c == CompressGzip {
+		return gzip.NewWriter(w), nil
+	}
+	cmd := exec.Command("zstd", "-q", "-c")
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting zstd: %w", err)
+	}
+	return &cmdWriter{WriteCloser: stdin, cmd: cmd}, nil
+}
+
+func (c Compression) reader(r io.Reader) (io.ReadCloser, error) {
+	if c == CompressGzip {
+		return gzip.NewReader(r)
+	}
+	cmd := exec.Command("zstd", "-q", "-dc")
+	cmd.Stdin = r
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting zstd: %w", err)
+	}
+	return &cmdReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// cmdWriter 向外部压缩命令的 stdin 写入，Close 时等待命令写完输出并退出
+type cmdWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (w *cmdWriter) Close() error {
+	w.WriteCloser.Close()
+	return w.cmd.Wait()
+}
+
+// cmdReader 读取外部解压命令的 stdout，Close 时等待命令退出
+type cmdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *cmdReader) Close() error {
+	return r.cmd.Wait()
+}
@@ -0,0 +1,497 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+// PartSuffix 是传输过程中临时文件的后缀，传输完成后才会重命名为目标文件
+const PartSuffix = ".kgate-part"
+
+// resumeOverlap 是续传上传时重新发送的数据量
+// 并发写入在中断时可能在文件末尾留下空洞，从稍早的位置重新写入可以覆盖它们
+const resumeOverlap = 8 << 20
+
+// Client 是经由跳板机连接到节点 sftp 子系统的客户端
+type Client struct {
+	*sftp.Client
+	cmd *exec.Cmd
+}
+
+// Options 控制单次传输的行为
+type Options struct {
+	Resume   bool        // 存在未完成的临时文件时从中断处继续
+	Progress func(int64) // 每传输一段数据后以字节数调用
+	Limiter  *Limiter    // 可选，限制传输速率
+	// OnFile 非空时，每个普通文件传输完成后调用，sum 是数据的 SHA-256（十六进制）：
+	// 上传时在读取本地文件的同时计算，下载时读取写入本地磁盘的文件计算
+	OnFile func(src, dst, sum string)
+	// OnSkip 非空时，下载因不安全而跳过远端条目（如指向目标之外的符号链接）时调用
+	OnSkip func(remote string, err error)
+	// Root 是下载写入的边界，解析符号链接后的本地路径必须位于其下；为空时以本次下载的目标为界
+	Root string
+}
+
+// Open 启动 cmd 并在其 stdin/stdout 上建立 SFTP 会话
+// cmd 需要是一个连接到远端 sftp 子系统的 ssh 命令，例如 ssh -s host sftp
+func Open(cmd *exec.Cmd) (*Client, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &stderrBuffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClientPipe(stdout, stdin, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		cmd.Process.Kill()
+		waitErr := cmd.Wait()
+		if msg := stderr.String(); msg != "" {
+			return nil, &SessionError{Err: waitErr, Stderr: msg}
+		}
+		return nil, fmt.Errorf("starting sftp session: %w", err)
+	}
+	return &Client{Client: client, cmd: cmd}, nil
+}
+
+// SessionError 表示 ssh 在建立 SFTP 会话前就失败了，Err 为 ssh 进程的退出错误
+type SessionError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *SessionError) Error() string {
+	return fmt.Sprintf("starting sftp session: %s", e.Stderr)
+}
+
+func (e *SessionError) Unwrap() error { return e.Err }
+
+// Close 结束 SFTP 会话并等待 ssh 退出
+func (c *Client) Close() error {
+	err := c.Client.Close()
+	c.cmd.Wait()
+	return err
+}
+
+// LocalSize 返回本地文件或目录树中所有普通文件的总大小
+func LocalSize(p string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// RemoteSize 返回远端文件或目录树中所有普通文件的总大小
+func (c *Client) RemoteSize(p string) (int64, error) {
+	var total int64
+	walker := c.Walk(p)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return 0, err
+		}
+		if walker.Stat().Mode().IsRegular() {
+			total += walker.Stat().Size()
+		}
+	}
+	return total, nil
+}
+
+// Upload 将本地文件或目录上传为远端路径 remote，目录会递归上传
+func (c *Client) Upload(local, remote string, opts Options) error {
+	info, err := os.Lstat(local)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(local)
+		if err != nil {
+			return err
+		}
+		c.Remove(remote)
+		return c.Symlink(target, remote)
+	case info.IsDir():
+		if err := c.MkdirAll(remote); err != nil {
+			return fmt.Errorf("creating %s: %w", remote, err)
+		}
+		entries, err := os.ReadDir(local)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := c.Upload(filepath.Join(local, entry.Name()), path.Join(remote, entry.Name()), opts); err != nil {
+				return err
+			}
+		}
+		// 目录的属性在写入内容之后设置，否则 mtime 会被文件的创建刷新
+		c.Chmod(remote, info.Mode().Perm())
+		return c.Chtimes(remote, info.ModTime(), info.ModTime())
+	case info.Mode().IsRegular():
+		return c.uploadFile(local, remote, info, opts)
+	}
+	return nil // 跳过设备文件、套接字等特殊文件
+}
+
+func (c *Client) uploadFile(local, remote string, info fs.FileInfo, opts Options) error {
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	part := remote + PartSuffix
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if opts.Resume {
+		if st, err := c.Stat(part); err == nil && st.Size() <= info.Size() {
+			offset = max(st.Size()-resumeOverlap, 0)
+			flags = os.O_WRONLY | os.O_CREATE
+		}
+	}
+
+	dst, err := c.OpenFile(part, flags)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", part, err)
+	}
+	if offset > 0 {
+		if _, err := src.Seek(offset, io.SeekStart); err != nil {
+			dst.Close()
+			return err
+		}
+		if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+			dst.Close()
+			return err
+		}
+		report(opts, offset)
+	}
+	h, err := newHash(opts, io.NewSectionReader(src, 0, offset))
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	_, err = dst.ReadFromWithConcurrency(&progressReader{r: io.TeeReader(src, h), opts: opts}, 0)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("uploading %s: %w", local, err)
+	}
+
+	if err := c.Chmod(part, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := c.rename(part, remote); err != nil {
+		return err
+	}
+	if err := c.Chtimes(remote, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	h.done(opts, local, remote)
+	return nil
+}
+
+// rename 用临时文件替换目标文件；不支持 posix-rename 扩展的服务端先删除目标再重命名
+func (c *Client) rename(from, to string) error {
+	if err := c.PosixRename(from, to); err == nil {
+		return nil
+	}
+	c.Remove(to)
+	return c.Rename(from, to)
+}
+
+// ErrUnsafePath 表示服务端返回的条目名或符号链接可能把数据写到下载目标之外
+var ErrUnsafePath = errors.New("unsafe path from server")
+
+// ValidName 报告服务端返回的目录条目名能否安全地用作本地文件名
+func ValidName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsRune(name, '/') && !strings.ContainsRune(name, filepath.Separator)
+}
+
+// Download 将远端文件或目录下载为本地路径 local，目录会递归下载
+// 服务端返回的内容是不可信的：含有 / 或为 .、.. 的条目名会导致下载失败，
+// 绝对路径或指向下载目标之外的符号链接会被跳过（通过 Options.OnSkip 报告），
+// 写入前还会确认解析符号链接后的实际路径仍在下载目标之下
+func (c *Client) Download(remote, local string, opts Options) error {
+	info, err := c.Lstat(remote)
+	if err != nil {
+		return err
+	}
+	if opts.Root == "" {
+		// 目录以自身为界；单个文件或符号链接以所在目录为界
+		opts.Root = local
+		if !info.IsDir() {
+			opts.Root = filepath.Dir(local)
+		}
+	}
+	return c.download(remote, local, info, opts)
+}
+
+func (c *Client) download(remote, local string, info fs.FileInfo, opts Options) error {
+	if local != opts.Root && !insideRoot(opts.Root, local) {
+		return fmt.Errorf("%w: %s is outside %s", ErrUnsafePath, local, opts.Root)
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := c.ReadLink(remote)
+		if err != nil {
+			return err
+		}
+		if !safeLink(opts.Root, local, target) {
+			skip(opts, remote, fmt.Errorf("%w: symlink target %q points outside the destination", ErrUnsafePath, target))
+			return nil
+		}
+		// 只替换文件和符号链接，不会删除已有的目录
+		if st, err := os.Lstat(local); err == nil && !st.IsDir() {
+			os.Remove(local)
+		}
+		return os.Symlink(target, local)
+	case info.IsDir():
+		if err := os.MkdirAll(local, 0755); err != nil {
+			return err
+		}
+		// 已有的同名符号链接会被 MkdirAll 跟随，它必须仍指向 Root 之下
+		if local != opts.Root && !resolvesInside(opts.Root, local) {
+			return fmt.Errorf("%w: %s is outside %s", ErrUnsafePath, local, opts.Root)
+		}
+		entries, err := c.ReadDir(remote)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !ValidName(entry.Name()) {
+				return fmt.Errorf("%w: %q in %s", ErrUnsafePath, entry.Name(), remote)
+			}
+			if err := c.download(path.Join(remote, entry.Name()), filepath.Join(local, entry.Name()), entry, opts); err != nil {
+				return err
+			}
+		}
+		os.Chmod(local, info.Mode().Perm())
+		return os.Chtimes(local, info.ModTime(), info.ModTime())
+	case info.Mode().IsRegular():
+		return c.downloadFile(remote, local, info, opts)
+	}
+	return nil
+}
+
+// insideRoot 报告 p 在解析其上级目录中的符号链接之后是否仍位于 root 之下，p 本身可以是符号链接
+func insideRoot(root, p string) bool {
+	dir, err := realPath(filepath.Dir(p))
+	return err == nil && within(root, filepath.Join(dir, filepath.Base(p)))
+}
+
+// resolvesInside 报告 p 解析全部符号链接之后是否仍位于 root 之下
+func resolvesInside(root, p string) bool {
+	resolved, err := realPath(p)
+	return err == nil && within(root, resolved)
+}
+
+// safeLink 报告在 local 创建指向 target 的符号链接后，链接是否仍指向 root 之下
+func safeLink(root, local, target string) bool {
+	if target == "" || filepath.IsAbs(target) {
+		return false
+	}
+	dir, err := realPath(filepath.Dir(local))
+	return err == nil && within(root, filepath.Join(dir, target))
+}
+
+// within 报告绝对路径 p 是否为 root（解析符号链接后）或位于其下
+func within(root, p string) bool {
+	realRoot, err := realPath(root)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realRoot, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath 返回解析全部符号链接之后的绝对路径
+func realPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+func skip(opts Options, remote string, err error) {
+	if opts.OnSkip != nil {
+		opts.OnSkip(remote, err)
+	}
+}
+
+func (c *Client) downloadFile(remote, local string, info fs.FileInfo, opts Options) error {
+	src, err := c.Open(remote)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	part := local + PartSuffix
+	// 临时文件必须是普通文件，否则打开时会跟随符号链接写到别处
+	if st, err := os.Lstat(part); err == nil && !st.Mode().IsRegular() {
+		if err := os.Remove(part); err != nil {
+			return err
+		}
+	}
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if opts.Resume {
+		// 本地按顺序写入，临时文件的大小就是已经完整接收的数据量
+		if st, err := os.Stat(part); err == nil && st.Size() <= info.Size() {
+			offset = st.Size()
+			flags = os.O_WRONLY | os.O_APPEND
+		}
+	}
+
+	dst, err := os.OpenFile(part, flags, 0600)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		if _, err := src.Seek(offset, io.SeekStart); err != nil {
+			dst.Close()
+			return err
+		}
+		report(opts, offset)
+	}
+	_, err = src.WriteTo(&progressWriter{w: dst, opts: opts})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", remote, err)
+	}
+
+	// 校验的是写入磁盘的内容而不是收到的数据流，本地写入出错时也能发现不一致；
+	// 续传时已有的部分也一并计算
+	var sum string
+	if opts.OnFile != nil {
+		if sum, err = FileSHA256(part); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(part, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Rename(part, local); err != nil {
+		return err
+	}
+	if err := os.Chtimes(local, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	if opts.OnFile != nil {
+		opts.OnFile(remote, local, sum)
+	}
+	return nil
+}
+
+// fileHash 在传输的同时计算数据的 SHA-256，未设置 Options.OnFile 时丢弃数据
+type fileHash struct {
+	hash.Hash
+}
+
+// newHash 创建上传文件的哈希，续传时 prefix 是已经传输过的那部分数据
+func newHash(opts Options, prefix io.Reader) (*fileHash, error) {
+	if opts.OnFile == nil {
+		return &fileHash{}, nil
+	}
+	h := &fileHash{Hash: sha256.New()}
+	if prefix != nil {
+		if _, err := io.Copy(h, prefix); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (h *fileHash) Write(p []byte) (int, error) {
+	if h.Hash == nil {
+		return len(p), nil
+	}
+	return h.Hash.Write(p)
+}
+
+func (h *fileHash) done(opts Options, src, dst string) {
+	if opts.OnFile != nil {
+		opts.OnFile(src, dst, hex.EncodeToString(h.Sum(nil)))
+	}
+}
+
+func report(opts Options, n int64) {
+	if opts.Progress != nil && n > 0 {
+		opts.Progress(n)
+	}
+}
+
+type progressReader struct {
+	r    io.Reader
+	opts Options
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.opts.Limiter.Wait(n)
+	report(p.opts, int64(n))
+	return n, err
+}
+
+type progressWriter struct {
+	w    io.Writer
+	opts Options
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.opts.Limiter.Wait(len(b))
+	n, err := p.w.Write(b)
+	report(p.opts, int64(n))
+	return n, err
+}
+
+// stderrBuffer 收集 ssh 的错误输出，可以在 ssh 写入的同时读取
+type stderrBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *stderrBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.TrimSpace(b.buf.String())
+}
@@ -0,0 +1,245 @@
+package transfer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// testClient 返回一个连接到进程内 SFTP 服务端的客户端，服务端直接访问本地文件系统
+func testClient(t *testing.T) *Client {
+	t.Helper()
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverR, serverW})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	client, err := sftp.NewClientPipe(clientR, clientW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// 先关闭服务端，客户端的接收协程才能读到 EOF 退出
+		server.Close()
+		client.Close()
+	})
+	return &Client{Client: client}
+}
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"file.txt", true},
+		{".hidden", true},
+		{"...", true},
+		{"a\\b", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"a/b", false},
+		{"../etc", false},
+		{"/etc", false},
+	}
+	for _, tt := range tests {
+		if got := ValidName(tt.name); got != tt.want {
+			t.Errorf("ValidName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidRel(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"a", true},
+		{"a/b/c", true},
+		{"", false},
+		{"a//b", false},
+		{"a/../b", false},
+		{"../a", false},
+		{"/a", false},
+	}
+	for _, tt := range tests {
+		if got := validRel(tt.rel); got != tt.want {
+			t.Errorf("validRel(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+	remote := filepath.Join(tmp, "remote")
+	mustMkdir(t, filepath.Join(remote, "sub"))
+	mustWrite(t, filepath.Join(remote, "a"), "a")
+	mustWrite(t, filepath.Join(remote, "sub", "b"), "b")
+	links := map[string]string{
+		"inside":      "sub/b",
+		"sub/up":      "../a",
+		"absolute":    "/etc/passwd",
+		"escape":      "../outside",
+		"parent":      "..",
+		"sub/escape2": "../../outside",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(remote, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	local := filepath.Join(tmp, "local")
+	var skipped []string
+	opts := Options{OnSkip: func(remote string, err error) {
+		if !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("OnSkip(%s) error = %v, want ErrUnsafePath", remote, err)
+		}
+		rel, _ := filepath.Rel(tmp, remote)
+		skipped = append(skipped, rel)
+	}}
+	if err := testClient(t).Download(remote, local, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(skipped)
+	want := []string{"remote/absolute", "remote/escape", "remote/parent", "remote/sub/escape2"}
+	if len(skipped) != len(want) {
+		t.Fatalf("skipped %v, want %v", skipped, want)
+	}
+	for i := range want {
+		if skipped[i] != want[i] {
+			t.Errorf("skipped %v, want %v", skipped, want)
+			break
+		}
+	}
+	for _, name := range []string{"absolute", "escape", "parent", "sub/escape2"} {
+		if _, err := os.Lstat(filepath.Join(local, name)); !os.IsNotExist(err) {
+			t.Errorf("unsafe symlink %s was created", name)
+		}
+	}
+	for name, want := range map[string]string{"a": "a", "sub/b": "b", "inside": "b", "sub/up": "a"} {
+		data, err := os.ReadFile(filepath.Join(local, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestDownloadRefusesExistingEscapingSymlink(t *testing.T) {
+	tmp := t.TempDir()
+	remote := filepath.Join(tmp, "remote")
+	mustMkdir(t, filepath.Join(remote, "sub"))
+	mustWrite(t, filepath.Join(remote, "sub", "b"), "b")
+
+	// 目标目录中已有一个指向外部的符号链接，下载不能通过它写到外部
+	outside := filepath.Join(tmp, "outside")
+	mustMkdir(t, outside)
+	local := filepath.Join(tmp, "local")
+	mustMkdir(t, local)
+	if err := os.Symlink(outside, filepath.Join(local, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := testClient(t).Download(remote, local, Options{})
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Fatalf("Download error = %v, want ErrUnsafePath", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "b")); !os.IsNotExist(err) {
+		t.Error("file written through an escaping symlink")
+	}
+}
+
+func TestDownloadRoot(t *testing.T) {
+	tmp := t.TempDir()
+	remote := filepath.Join(tmp, "remote")
+	mustMkdir(t, remote)
+	mustWrite(t, filepath.Join(remote, "f"), "f")
+	outside := filepath.Join(tmp, "outside")
+	mustMkdir(t, outside)
+	local := filepath.Join(tmp, "local")
+	mustMkdir(t, local)
+	if err := os.Symlink(outside, filepath.Join(local, "dir")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := testClient(t)
+	// 逐个下载文件时（如 sync），Root 限定了整个同步目录
+	err := c.Download(filepath.Join(remote, "f"), filepath.Join(local, "dir", "f"), Options{Root: local})
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Fatalf("Download error = %v, want ErrUnsafePath", err)
+	}
+	if err := c.Download(filepath.Join(remote, "f"), filepath.Join(local, "f"), Options{Root: local}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustMkdir(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustWrite(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	tmp := t.TempDir()
+	remote := filepath.Join(tmp, "remote")
+	mustWrite(t, remote, "hello world")
+	local := filepath.Join(tmp, "local")
+	want, err := FileSHA256(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		partial string // 续传前已经存在的临时文件内容
+		resume  bool
+		intact  bool // 下载得到的文件是否与远端一致
+	}{
+		{name: "fresh", intact: true},
+		{name: "resume", partial: "hello", resume: true, intact: true},
+		// 临时文件的内容与远端不同时，续传得到的文件与远端不一致，校验和必须反映这一点
+		{name: "corrupt partial", partial: "HELLO", resume: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(local)
+			if tt.partial != "" {
+				mustWrite(t, local+PartSuffix, tt.partial)
+			}
+			var got string
+			opts := Options{Resume: tt.resume, OnFile: func(src, dst, sum string) { got = sum }}
+			if err := testClient(t).Download(remote, local, opts); err != nil {
+				t.Fatal(err)
+			}
+			written, err := FileSHA256(local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != written {
+				t.Errorf("OnFile sum %s does not match the written file %s", got, written)
+			}
+			if (got == want) != tt.intact {
+				t.Errorf("OnFile sum %s, remote %s, want intact=%v", got, want, tt.intact)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry 是目录树中的一个条目，Path 是相对于树根、以 / 分隔的路径
+type Entry struct {
+	Path    string
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+	Link    string // 符号链接的目标
+}
+
+// IsDir 判断条目是否为目录
+func (e Entry) IsDir() bool { return e.Mode.IsDir() }
+
+// IsRegular 判断条目是否为普通文件
+func (e Entry) IsRegular() bool { return e.Mode.IsRegular() }
+
+// Tree 是以相对路径为键的目录树
+type Tree map[string]Entry
+
+// Paths 返回按路径排序的所有条目，父目录总是排在其内容之前
+func (t Tree) Paths() []string {
+	paths := make([]string, 0, len(t))
+	for p := range t {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Excludes 是一组排除模式，模式语法同 path.Match
+// 不含 / 的模式匹配任意层级的文件名，含 / 的模式匹配相对于树根的完整路径
+type Excludes []string
+
+// Match 判断相对路径 rel 是否被排除；被排除的目录连同其内容一起跳过
+func (x Excludes) Match(rel string) bool {
+	for _, pattern := range x {
+		pattern = strings.TrimSuffix(pattern, "/")
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalTree 读取本地目录 root 下的目录树，root 不存在时返回空树
+func LocalTree(root string, excludes Excludes) (Tree, error) {
+	tree := Tree{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if excludes.Match(rel) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := Entry{Path: rel, Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if entry.Link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		tree[rel] = entry
+		return nil
+	})
+	return tree, err
+}
+
+// RemoteTree 读取远端目录 root 下的目录树，root 不存在时返回空树
+func (c *Client) RemoteTree(root string, excludes Excludes) (Tree, error) {
+	tree := Tree{}
+	root = path.Clean(root)
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	if root == "." {
+		prefix = ""
+	}
+	walker := c.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == root && errors.Is(err, fs.ErrNotExist) {
+				return tree, nil
+			}
+			return nil, err
+		}
+		if walker.Path() == root {
+			continue
+		}
+		rel, ok := strings.CutPrefix(walker.Path(), prefix)
+		if (!ok && prefix != "") || !validRel(rel) {
+			return nil, fmt.Errorf("%w: %q in %s", ErrUnsafePath, walker.Path(), root)
+		}
+		info := walker.Stat()
+		if excludes.Match(rel) {
+			if info.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		entry := Entry{Path: rel, Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			link, err := c.ReadLink(walker.Path())
+			if err != nil {
+				return nil, err
+			}
+			entry.Link = link
+		}
+		tree[rel] = entry
+	}
+	return tree, nil
+}
+
+// validRel 报告以 / 分隔的相对路径中的每一段是否都是合法的条目名
+func validRel(rel string) bool {
+	for _, name := range strings.Split(rel, "/") {
+		if !ValidName(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Plan 是将目标树同步为源树所需的操作
+type Plan struct {
+	Add       []Entry // 源中有而目标中没有的条目
+	Update    []Entry // 两边都有但内容或类型不同的条目
+	Delete    []Entry // 目标中有而源中没有的条目，按路径倒序排列以便先删除内容再删除目录
+	Unchanged int
+}
+
+// Bytes 返回执行计划需要传输的数据量
+func (p *Plan) Bytes() int64 {
+	var total int64
+	for _, list := range [][]Entry{p.Add, p.Update} {
+		for _, e := range list {
+			if e.IsRegular() {
+				total += e.Size
+			}
+		}
+	}
+	return total
+}
+
+// Empty 判断两棵树是否已经一致
+func (p *Plan) Empty() bool {
+	return len(p.Add) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// Diff 比较源树和目标树，changed 判断两边都是普通文件的同名条目内容是否不同
+func Diff(src, dst Tree, changed func(src, dst Entry) bool) *Plan {
+	plan := &Plan{}
+	for _, p := range src.Paths() {
+		s := src[p]
+		d, ok := dst[p]
+		switch {
+		case !ok:
+			plan.Add = append(plan.Add, s)
+		case s.Mode.Type() != d.Mode.Type():
+			plan.Update = append(plan.Update, s)
+		case s.IsRegular() && changed(s, d):
+			plan.Update = append(plan.Update, s)
+		case s.Link != d.Link:
+			plan.Update = append(plan.Update, s)
+		default:
+			plan.Unchanged++
+		}
+	}
+	paths := dst.Paths()
+	for i := len(paths) - 1; i >= 0; i-- {
+		if _, ok := src[paths[i]]; !ok && !replaced(src, paths[i]) {
+			plan.Delete = append(plan.Delete, dst[paths[i]])
+		}
+	}
+	return plan
+}
+
+// replaced 判断 p 的某个上级目录在源树中已经不是目录，这时整个目录会随类型变化一起被替换
+func replaced(src Tree, p string) bool {
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if e, ok := src[dir]; ok && !e.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangedBySizeAndTime 以大小和修改时间（精确到秒，SFTP 只保留秒）判断文件是否不同
+func ChangedBySizeAndTime(src, dst Entry) bool {
+	return src.Size != dst.Size || src.ModTime.Unix() != dst.ModTime.Unix()
+}
+
+// FileSHA256 计算本地文件的 SHA-256，以十六进制返回
+func FileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
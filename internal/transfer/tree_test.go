@@ -0,0 +1,189 @@
+package transfer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExcludesMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		rel      string
+		want     bool
+	}{
+		{[]string{"*.log"}, "app.log", true},
+		{[]string{"*.log"}, "logs/deep/app.log", true},
+		{[]string{"*.log"}, "app.log.1", false},
+		{[]string{"node_modules"}, "web/node_modules", true},
+		{[]string{"node_modules/"}, "web/node_modules", true},
+		{[]string{"build/tmp"}, "build/tmp", true},
+		{[]string{"build/tmp"}, "src/build/tmp", false},
+		{[]string{"/build"}, "build", true},
+		{[]string{"/build"}, "src/build", false},
+		{[]string{"build/*.o"}, "build/main.o", true},
+		{[]string{"build/*.o"}, "build/sub/main.o", false},
+		{[]string{"?.txt"}, "a.txt", true},
+		{[]string{"[ab].txt"}, "c.txt", false},
+		{[]string{"*.log", "tmp"}, "tmp", true},
+		{nil, "anything", false},
+	}
+	for _, tt := range tests {
+		if got := Excludes(tt.patterns).Match(tt.rel); got != tt.want {
+			t.Errorf("Excludes(%q).Match(%q) = %v, want %v", tt.patterns, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	t1 := t0.Add(time.Hour)
+	file := func(p string, size int64, mtime time.Time) Entry {
+		return Entry{Path: p, Size: size, Mode: 0644, ModTime: mtime}
+	}
+	dir := func(p string) Entry { return Entry{Path: p, Mode: fs.ModeDir | 0755} }
+	link := func(p, target string) Entry { return Entry{Path: p, Mode: fs.ModeSymlink | 0777, Link: target} }
+	tree := func(entries ...Entry) Tree {
+		t := Tree{}
+		for _, e := range entries {
+			t[e.Path] = e
+		}
+		return t
+	}
+
+	tests := []struct {
+		name      string
+		src, dst  Tree
+		add       []string
+		update    []string
+		delete    []string
+		unchanged int
+	}{
+		{
+			name: "empty destination",
+			src:  tree(dir("d"), file("d/a", 1, t0)),
+			dst:  tree(),
+			add:  []string{"d", "d/a"},
+		},
+		{
+			name:      "in sync",
+			src:       tree(file("a", 1, t0)),
+			dst:       tree(file("a", 1, t0.Add(500*time.Millisecond))),
+			unchanged: 1,
+		},
+		{
+			name:   "size and mtime",
+			src:    tree(file("a", 1, t0), file("b", 2, t1)),
+			dst:    tree(file("a", 2, t0), file("b", 2, t0)),
+			update: []string{"a", "b"},
+		},
+		{
+			name:      "symlink target",
+			src:       tree(link("l", "x"), link("m", "y")),
+			dst:       tree(link("l", "x"), link("m", "z")),
+			update:    []string{"m"},
+			unchanged: 1,
+		},
+		{
+			name:   "deleted entries in reverse order",
+			src:    tree(),
+			dst:    tree(dir("d"), file("d/a", 1, t0), file("d/b", 1, t0)),
+			delete: []string{"d/b", "d/a", "d"},
+		},
+		{
+			// 目录被文件替换时，目录下的内容随替换一起删除，不再单独列出
+			name:   "directory replaced by file",
+			src:    tree(file("d", 1, t0)),
+			dst:    tree(dir("d"), file("d/a", 1, t0)),
+			update: []string{"d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := Diff(tt.src, tt.dst, ChangedBySizeAndTime)
+			check := func(kind string, got []Entry, want []string) {
+				var paths []string
+				for _, e := range got {
+					paths = append(paths, e.Path)
+				}
+				if !slices.Equal(paths, want) {
+					t.Errorf("%s = %v, want %v", kind, paths, want)
+				}
+			}
+			check("add", plan.Add, tt.add)
+			check("update", plan.Update, tt.update)
+			check("delete", plan.Delete, tt.delete)
+			if plan.Unchanged != tt.unchanged {
+				t.Errorf("unchanged = %d, want %d", plan.Unchanged, tt.unchanged)
+			}
+			if empty := len(tt.add)+len(tt.update)+len(tt.delete) == 0; plan.Empty() != empty {
+				t.Errorf("Empty() = %v, want %v", plan.Empty(), empty)
+			}
+		})
+	}
+}
+
+func TestPlanBytes(t *testing.T) {
+	plan := &Plan{
+		Add:    []Entry{{Path: "a", Size: 10, Mode: 0644}, {Path: "d", Size: 4096, Mode: fs.ModeDir}},
+		Update: []Entry{{Path: "b", Size: 5, Mode: 0644}, {Path: "l", Size: 3, Mode: fs.ModeSymlink}},
+		Delete: []Entry{{Path: "c", Size: 100, Mode: 0644}},
+	}
+	if got := plan.Bytes(); got != 15 {
+		t.Errorf("Bytes() = %d, want 15", got)
+	}
+}
+
+func TestLocalTree(t *testing.T) {
+	root := t.TempDir()
+	mustMkdir(t, filepath.Join(root, "src", "tmp"))
+	mustWrite(t, filepath.Join(root, "src", "main.go"), "package main")
+	mustWrite(t, filepath.Join(root, "src", "tmp", "x"), "x")
+	mustWrite(t, filepath.Join(root, "debug.log"), "log")
+	if err := os.Symlink("src/main.go", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := LocalTree(root, Excludes{"*.log", "src/tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"link", "src", "src/main.go"}
+	if got := tree.Paths(); !slices.Equal(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+	if tree["link"].Link != "src/main.go" {
+		t.Errorf("link target = %q", tree["link"].Link)
+	}
+
+	missing, err := LocalTree(filepath.Join(root, "missing"), nil)
+	if err != nil || len(missing) != 0 {
+		t.Errorf("LocalTree of a missing root = %v, %v; want empty", missing, err)
+	}
+}
+
+func TestRemoteTreeMatchesLocalTree(t *testing.T) {
+	root := t.TempDir()
+	mustMkdir(t, filepath.Join(root, "a", "b"))
+	mustWrite(t, filepath.Join(root, "a", "b", "f"), "data")
+	mustWrite(t, filepath.Join(root, "a", "skip.log"), "log")
+	if err := os.Symlink("a/b/f", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	excludes := Excludes{"*.log"}
+	local, err := LocalTree(root, excludes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := testClient(t).RemoteTree(root, excludes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan := Diff(local, remote, ChangedBySizeAndTime); !plan.Empty() {
+		t.Errorf("trees differ: %+v", plan)
+	}
+}